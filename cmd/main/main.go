@@ -1,26 +1,96 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 
+	"ls-todo/internal/clock"
 	"ls-todo/internal/config"
 	"ls-todo/internal/db"
+	"ls-todo/internal/jobs"
+	"ls-todo/internal/logging"
+	"ls-todo/internal/moderation"
+	"ls-todo/internal/reporting"
 	"ls-todo/internal/server"
+	"ls-todo/internal/version"
 )
 
 func main() {
+	printConfig := flag.Bool("print-config", false, "print the config (with secrets redacted) and exit")
+	flag.Parse()
+
+	// Exiting skips deferred calls, so everything is done in run, whose deferred calls close
+	// the connections and files, and we only exit once it has returned. We log the error
+	// ourselves since `log.Fatalf` would log it at the info level, as the standard logger
+	// writes through slog, so it would be dropped whenever the log level is above info and the
+	// server would exit without saying why.
+	if err := run(*printConfig); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// run starts the server, and only returns if it fails to start or stops serving.
+func run(printConfig bool) error {
+	// We use a structured logger so that the level can be changed at runtime. Setting it as
+	// the default also sends everything written with the standard `log` package through it
+	// (at the info level). We include the version in every line so it's clear which build
+	// wrote it.
+	slog.SetDefault(logging.New(os.Stderr).With("version", version.Version))
+	log.Printf("starting ls-todo %s (commit %s, built %s)", version.Version, version.Commit, version.BuildDate)
+
 	// First we get the environment variables of the application. If there is an error processing
 	// these we shut down the application and log the error so we can see what went wrong.
 	cfg, err := config.New()
 	if err != nil {
-		log.Fatalf("error processing environment config: %v", err)
+		return fmt.Errorf("error processing environment config: %w", err)
+	}
+	if err := logging.Level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return fmt.Errorf("error processing environment config: invalid LOG_LEVEL: %w", err)
+	}
+	if _, err := db.ParseSort(cfg.DefaultSort); err != nil {
+		return fmt.Errorf("error processing environment config: invalid DEFAULT_SORT: %w", err)
+	}
+	// Now that we have the config we know whether to log to a file instead. Anything logged
+	// before this point went to stderr.
+	if cfg.LogFile != "" {
+		logFile, err := cfg.OpenLogFile(cfg.LogFile)
+		if err != nil {
+			return fmt.Errorf("error opening log file: %w", err)
+		}
+		// Logging goes back to stderr before the file is closed, so that the error run
+		// returns is still written somewhere.
+		defer func() {
+			slog.SetDefault(logging.New(os.Stderr).With("version", version.Version))
+			logFile.Close()
+		}()
+		slog.SetDefault(logging.New(logFile).With("version", version.Version))
+	}
+	// `--print-config` is handy for checking what the app will run with. We only ever print
+	// the redacted config so that credentials don't end up in terminals or CI logs.
+	if printConfig {
+		if err := json.NewEncoder(os.Stdout).Encode(cfg.Redacted()); err != nil {
+			return fmt.Errorf("error printing config: %w", err)
+		}
+		return nil
 	}
+	log.Printf("starting with config: %+v", cfg.Redacted())
+	if cfg.ChaosLatency > 0 || cfg.ChaosErrorRate > 0 || cfg.ChaosDBErrorRate > 0 {
+		slog.Warn("fault injection is enabled", "latency", cfg.ChaosLatency,
+			"error_rate", cfg.ChaosErrorRate, "db_error_rate", cfg.ChaosDBErrorRate)
+	}
+
 	// Here we create the router that we will be using in our application, and pass it to the
 	// constructor function of our server.
 	router := mux.NewRouter()
@@ -31,12 +101,11 @@ func main() {
 	connString := db.GetConnString(cfg)
 	dbConn, err := sqlx.Connect("postgres", connString)
 	if err != nil {
-		log.Fatalf("error connecting to database: %v", err)
+		return fmt.Errorf("error connecting to database: %w", err)
 	}
 	// In order to prevent dangling open connections after our app closes, we use the `defer`
-	// keyword. This ensures that the `dbConn.Close()` method will be called before the `main`
-	// function finishes executing. It will also close the connection if there is an error that
-	// crashes our program.
+	// keyword. This ensures that the `dbConn.Close()` method will be called before the `run`
+	// function finishes executing, including when it returns an error.
 	defer dbConn.Close()
 
 	// Next we ping the database to make sure we have an established connection.
@@ -45,18 +114,122 @@ func main() {
 	// the `err` variable on L15. Though we don't need to here, it would allow us to use the
 	// previous `err` variable again after the `if` block.
 	if err := dbConn.Ping(); err != nil {
-		log.Fatalf("error pinging database: %v", err)
+		return fmt.Errorf("error pinging database: %w", err)
 	}
 	log.Println("successfully connected to database")
-	pgManager := db.New(dbConn)
 
-	s := server.New(router, pgManager)
+	// A missing index means a migration wasn't run. Things still work without it, just
+	// slowly, so unless we're told to be strict we only warn about it.
+	missing, err := db.MissingIndexes(dbConn)
+	if err != nil {
+		return fmt.Errorf("error checking database indexes: %w", err)
+	}
+	if len(missing) > 0 {
+		if cfg.SchemaStrict {
+			return fmt.Errorf("database is missing indexes: %v", missing)
+		}
+		slog.Warn("database is missing indexes", "indexes", missing)
+	}
+
+	// In test environments the clock can be frozen and moved through the test API, so that
+	// tests can check time-dependent behaviour. Everywhere else it is the real time.
+	var clk clock.Clock = clock.Real{}
+	if cfg.TestFixtures {
+		clk = clock.NewFake()
+	}
+
+	// Identical reads that arrive at the same time share a single query.
+	pgManager := db.Deduplicate(db.New(dbConn, cfg, clk))
+
+	// Admin reports are run against a read replica when one is configured, so that analysts
+	// can't slow down the database serving our users. Without one, we reuse the connection to
+	// the primary.
+	replicaConn := dbConn
+	if cfg.PGReplicaHost != "" {
+		replicaConn, err = sqlx.Connect("postgres", db.GetReplicaConnString(cfg))
+		if err != nil {
+			return fmt.Errorf("error connecting to read replica: %w", err)
+		}
+		defer replicaConn.Close()
+	}
+	reporter := db.NewReporter(replicaConn)
+
+	// Unexpected errors are sent to Sentry when it's configured, and logged otherwise.
+	errReporter, err := reporting.New(cfg.SentryDSN, cfg.SentryEnvironment, version.Version)
+	if err != nil {
+		return fmt.Errorf("error configuring error reporting: %w", err)
+	}
+
+	// New and changed todos are checked by the content filter, which allows everything unless
+	// one is configured.
+	filter, err := moderation.New(cfg)
+	if err != nil {
+		return fmt.Errorf("error configuring the content filter: %w", err)
+	}
+
+	s := server.New(router, pgManager, reporter, errReporter, filter, cfg, clk)
+
+	// The database has to have every migration this build relies on, or it would write to
+	// tables and columns that don't exist yet. That happens when a deploy starts the new build
+	// before the migrations have run. Depending on the config, we either refuse to start or
+	// serve reads only, which is enough for the old build's traffic to move over safely.
+	schema, err := pgManager.GetSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("error checking the database schema version: %w", err)
+	}
+	if !schema.Compatible() {
+		if cfg.SchemaMismatch != "read_only" {
+			return fmt.Errorf("database schema version %d (dirty: %t) is incompatible: this build needs %d or later",
+				schema.Version, schema.Dirty, schema.Required)
+		}
+		slog.Error("database schema is incompatible, serving read-only",
+			"version", schema.Version, "dirty", schema.Dirty, "required", schema.Required)
+		s.SetReadOnly(true)
+	}
+
+	// Background jobs run in their own goroutines so they don't block the HTTP server. The
+	// ones that change the database are singletons, so that only one instance runs them.
+	// They would write to an incompatible schema just like requests would, so a read-only
+	// server doesn't start them at all; the instances running the old build keep them going.
+	if !schema.Compatible() {
+		slog.Warn("not starting the jobs that write to the database, since its schema is incompatible")
+	} else {
+		if cfg.RetentionCompletedDays > 0 {
+			purge := jobs.PurgeExpiredTodos(cfg, pgManager, clk)
+			go jobs.Every(clk, cfg.RetentionInterval, "purge-expired-todos",
+				jobs.Singleton(pgManager, "purge-expired-todos", purge))
+		}
+		if cfg.EventArchiveDays > 0 {
+			archive := jobs.ArchiveTodoEvents(cfg, pgManager, clk)
+			go jobs.Every(clk, cfg.EventArchiveInterval, "archive-todo-events",
+				jobs.Singleton(pgManager, "archive-todo-events", archive))
+		}
+	}
+	// The monitor reports jobs that stop running or keep failing.
+	go jobs.Monitor(clk, time.Minute, cfg.JobFailureThreshold, errReporter)
+
+	// The access log is added around the whole server (rather than as a router middleware)
+	// so that it also sees requests that don't match any route.
+	accessLogSink := io.Writer(os.Stdout)
+	if cfg.AccessLogFile != "" {
+		f, err := cfg.OpenLogFile(cfg.AccessLogFile)
+		if err != nil {
+			return fmt.Errorf("error opening access log: %w", err)
+		}
+		defer f.Close()
+		accessLogSink = f
+	}
+	accessLog, err := server.AccessLog(accessLogSink, cfg.AccessLogFormat)
+	if err != nil {
+		return fmt.Errorf("error configuring access log: %w", err)
+	}
 
 	// Since our server instance implements the `http.Handler` interface (because of our router), we
 	// cann use it as the second argument to `http.ListenAndServe`. This makes Go use our router for
 	// routing instead of the default router of the net/http package.
 	log.Printf("listening on port %d\n", cfg.Port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), s); err != nil {
-		log.Fatalf("error starting HTTP server: %v", err)
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), accessLog(s)); err != nil {
+		return fmt.Errorf("error starting HTTP server: %w", err)
 	}
+	return nil
 }
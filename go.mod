@@ -1,10 +1,14 @@
 module ls-todo
 
-go 1.13
+go 1.21
 
 require (
 	github.com/gorilla/mux v1.7.4
+	github.com/jackc/pgerrcode v0.0.0-20250907135507-afb5586c32a6
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/lib/pq v1.7.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	golang.org/x/sync v0.10.0
+	golang.org/x/text v0.21.0
 )
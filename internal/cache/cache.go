@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache is a short-lived, in-process cache for responses that are expensive to compute (like
+// stats and reports). It stores encoded response bodies along with an ETag for each.
+//
+// Besides remembering results, it makes sure a value is only computed once at a time: if ten
+// requests for the same key arrive while it is being computed, they all wait for and share
+// that one result instead of each running the query.
+type Cache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]entry
+
+	// group deduplicates concurrent computations of the same key.
+	group singleflight.Group
+}
+
+// entry is a cached value.
+type entry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// New returns a Cache that keeps values for ttl.
+func New(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, entries: map[string]entry{}}
+}
+
+// Get returns the cached body and ETag for key. If there is no fresh value, it calls compute
+// to produce one and caches it. Errors are returned to every caller waiting on that
+// computation and are not cached.
+func (c *Cache) Get(key string, compute func() ([]byte, error)) ([]byte, string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.body, e.etag, nil
+	}
+
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		body, err := compute()
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(body)
+		e := entry{
+			body:    body,
+			etag:    `"` + hex.EncodeToString(sum[:8]) + `"`,
+			expires: time.Now().Add(c.ttl),
+		}
+		c.set(key, e)
+		return e, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	e = v.(entry)
+	return e.body, e.etag, nil
+}
+
+// TTL returns how long values are cached for.
+func (c *Cache) TTL() time.Duration {
+	return c.ttl
+}
+
+// set stores an entry, and takes the chance to drop any expired ones so that the cache can't
+// grow forever with keys that are never asked for again.
+func (c *Cache) set(key string, e entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, old := range c.entries {
+		if now.After(old.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = e
+}
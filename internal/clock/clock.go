@@ -0,0 +1,144 @@
+// Package clock lets code ask for the current time through an interface, so that tests can
+// control it. Anything that depends on what time it is (whether a todo is overdue, when a
+// share expires, which todos retention purges) should get it from a Clock rather than calling
+// time.Now directly.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel that receives the time once d has passed on the clock.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the Clock for production: it returns the actual time.
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Fake is a Clock that can be frozen at a given time and moved forwards, so tests can check
+// time-dependent behaviour (e.g. a todo becoming overdue) without waiting for it. Until it is
+// frozen or moved, it follows the real time.
+type Fake struct {
+	mu sync.Mutex
+	// offset is added to the real time while the clock isn't frozen.
+	offset time.Duration
+	// frozen is the time the clock is stopped at, or nil if it is running.
+	frozen *time.Time
+	// waiters are the channels returned by After that haven't fired yet.
+	waiters []waiter
+}
+
+// waiter is a channel returned by After, and the time it fires at.
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewFake returns a Fake that starts out following the real time.
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now()
+}
+
+func (f *Fake) now() time.Time {
+	if f.frozen != nil {
+		return *f.frozen
+	}
+	return time.Now().Add(f.offset)
+}
+
+// After fires once the clock reaches d from now, whether that is by the real time passing
+// while the clock is running or by Set or Advance moving it there.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := make(chan time.Time, 1)
+	f.waiters = append(f.waiters, waiter{at: f.now().Add(d), c: c})
+	f.fire()
+	return c
+}
+
+// wake fires the waiters that are due.
+func (f *Fake) wake() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fire()
+}
+
+// fire sends the time to the waiters that are due, and forgets them. While the clock is
+// running, it also sets a timer to come back when the next one is due. f.mu must be held.
+func (f *Fake) fire() {
+	now := f.now()
+	pending := f.waiters[:0]
+	var next time.Time
+	for _, w := range f.waiters {
+		if w.at.After(now) {
+			pending = append(pending, w)
+			if next.IsZero() || w.at.Before(next) {
+				next = w.at
+			}
+			continue
+		}
+		w.c <- now
+	}
+	f.waiters = pending
+	if f.frozen == nil && !next.IsZero() {
+		time.AfterFunc(next.Sub(now), f.wake)
+	}
+}
+
+// Frozen returns whether the clock is stopped.
+func (f *Fake) Frozen() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.frozen != nil
+}
+
+// Set stops the clock at t.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frozen = &t
+	f.fire()
+}
+
+// Advance moves the clock forwards by d (or backwards, if d is negative). A stopped clock
+// stays stopped at the new time.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.frozen != nil {
+		t := f.frozen.Add(d)
+		f.frozen = &t
+	} else {
+		f.offset += d
+	}
+	f.fire()
+}
+
+// Reset makes the clock follow the real time again.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frozen = nil
+	f.offset = 0
+	f.fire()
+}
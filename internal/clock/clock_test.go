@@ -0,0 +1,44 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeAfter(t *testing.T) {
+	f := NewFake()
+	start := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	f.Set(start)
+
+	c := f.After(time.Hour)
+	f.Advance(59 * time.Minute)
+	select {
+	case <-c:
+		t.Fatal("After fired before its time")
+	default:
+	}
+	f.Advance(time.Minute)
+	select {
+	case now := <-c:
+		if want := start.Add(time.Hour); !now.Equal(want) {
+			t.Errorf("After sent %v, want %v", now, want)
+		}
+	default:
+		t.Fatal("After didn't fire once the clock reached its time")
+	}
+
+	// Resetting the clock moves it on to the real time, which is past the deadline.
+	c = f.After(time.Hour)
+	f.Reset()
+	c2 := f.After(time.Millisecond)
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatal("After didn't fire after the clock was reset")
+	}
+	select {
+	case <-c2:
+	case <-time.After(time.Second):
+		t.Fatal("After didn't fire on a running clock")
+	}
+}
@@ -1,16 +1,237 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"ls-todo/internal/logging"
+)
+
+// redacted is what secret values are replaced with by Redacted.
+const redacted = "[REDACTED]"
 
 // Config is the application's runtime environment.
+//
+// Fields tagged with `secret:"true"` hold credentials. They are hidden by Redacted, and New
+// refuses to start if one of their values is also used for a field that isn't secret (e.g. the
+// password accidentally pasted into PG_USER), since that field might end up in a log.
 type Config struct {
 	Port       int    `envconfig:"port" required:"true"`
 	PGPort     int    `envconfig:"pg_port" required:"true"`
 	PGHost     string `envconfig:"pg_host" required:"true"`
 	PGDatabase string `envconfig:"pg_database" required:"true"`
 	PGUser     string `envconfig:"pg_user" required:"true"`
-	PGPassword string `envconfig:"pg_password" required:"true"`
+	PGPassword string `envconfig:"pg_password" required:"true" secret:"true"`
 	PGSSLMode  string `envconfig:"pg_sslmode" required:"true"`
+	// PGReplicaHost is the host of a read replica of the database. Expensive read-only queries
+	// (e.g. admin reports) are sent here when it is set. It uses the same port and credentials
+	// as the primary.
+	PGReplicaHost string `envconfig:"pg_replica_host"`
+
+	// MaintenanceBanner puts the server in maintenance mode from startup, with this message
+	// for clients to show. In maintenance mode reads work as usual but anything that would
+	// change data is refused. It can also be turned on and off through the admin API.
+	MaintenanceBanner string `envconfig:"maintenance_banner"`
+
+	// Region names the region this instance runs in, for multi-region deployments. It is sent
+	// in the X-Region header of every response so clients can tell which region served them.
+	Region string `envconfig:"region"`
+	// RegionWeight is how much traffic this instance should get relative to the others,
+	// advertised by the health and ping endpoints for load balancers that support weighting.
+	// Zero asks for no new traffic, e.g. while draining a region.
+	RegionWeight int `envconfig:"region_weight" default:"100"`
+
+	// SchemaStrict makes the server refuse to start if the database is missing indexes it
+	// expects. Otherwise it only logs a warning.
+	SchemaStrict bool `envconfig:"schema_strict"`
+	// SchemaMismatch is what the server does when the database's migrations are older than
+	// the code needs, or a migration failed partway: "refuse" to start, or start "read_only",
+	// serving reads but refusing writes until the migrations have caught up and the server
+	// is restarted.
+	SchemaMismatch string `envconfig:"schema_mismatch" default:"refuse"`
+
+	// LogLevel is the minimum level logged at startup: debug, info, warn or error. It can be
+	// changed at runtime through the admin API.
+	LogLevel string `envconfig:"log_level" default:"info"`
+
+	// LogFile is the file application logs are written to. If it is empty they are written to
+	// stderr. The file (and the access log file) is rotated according to the settings below.
+	LogFile string `envconfig:"log_file"`
+	// LogMaxSizeMB is the size in megabytes at which a log file is rotated.
+	LogMaxSizeMB int `envconfig:"log_max_size_mb" default:"100"`
+	// LogMaxAge is how long a log file is written to before it is rotated.
+	LogMaxAge time.Duration `envconfig:"log_max_age" default:"24h"`
+	// LogMaxBackups is how many rotated log files are kept.
+	LogMaxBackups int `envconfig:"log_max_backups" default:"7"`
+
+	// AccessLogFormat is the format of the access log: combined, json or off.
+	AccessLogFormat string `envconfig:"access_log_format" default:"combined"`
+	// AccessLogFile is the file the access log is appended to. If it is empty, the access log
+	// is written to stdout.
+	AccessLogFile string `envconfig:"access_log_file"`
+
+	// AdminToken is the bearer token required by the /api/admin endpoints. If it is empty the
+	// admin endpoints are disabled.
+	AdminToken string `envconfig:"admin_token" secret:"true"`
+	// ReportRowLimit is the maximum number of rows an admin report can return.
+	ReportRowLimit int `envconfig:"report_row_limit" default:"1000"`
+
+	// Timezone is the IANA name of the time zone used for dates, e.g. when deciding whether a
+	// todo is overdue.
+	Timezone string `envconfig:"timezone" default:"UTC"`
+
+	// SlowQueryThreshold is how long a database query can take before it is logged as a
+	// warning and counted as slow. Zero turns this off. All queries are logged at debug level.
+	SlowQueryThreshold time.Duration `envconfig:"slow_query_threshold" default:"200ms"`
+
+	// DefaultPageSize is how many todos are returned by list endpoints when the client
+	// doesn't ask for a specific number.
+	DefaultPageSize int `envconfig:"default_page_size" default:"100"`
+	// MaxPageSize is the most todos a single request can return, whatever the client asks for.
+	MaxPageSize int `envconfig:"max_page_size" default:"1000"`
+	// DefaultSort is the order of GET /api/todos when the client doesn't ask for one, written
+	// like the `sort` query parameter (e.g. `-created_at`). If it is empty, starred todos come
+	// first and the rest are in the order they were created.
+	DefaultSort string `envconfig:"default_sort"`
+
+	// StrictRequestFields rejects requests that use the legacy day, month and year fields
+	// instead of due_date, as if every client had sent `Prefer: handling=strict`.
+	StrictRequestFields bool `envconfig:"strict_request_fields"`
+
+	// SummaryDescriptionLength is how many characters of each description are included when
+	// todos are listed with `?view=summary`.
+	SummaryDescriptionLength int `envconfig:"summary_description_length" default:"140"`
+
+	// MaxInFlightRequests is the maximum number of requests handled at once. Requests beyond
+	// that are turned away with a 503 rather than queueing up for database connections. Zero
+	// disables the limit.
+	MaxInFlightRequests int `envconfig:"max_in_flight_requests" default:"100"`
+
+	// SecurityHeaders controls whether the security headers (X-Frame-Options etc.) are added
+	// to every response. Deployments that set these at a proxy can turn it off.
+	SecurityHeaders bool `envconfig:"security_headers" default:"true"`
+	// ContentSecurityPolicy is the Content-Security-Policy header sent with every response.
+	// The default allows nothing, which suits a JSON API; it will need loosening to serve a UI.
+	ContentSecurityPolicy string `envconfig:"content_security_policy" default:"default-src 'none'; frame-ancestors 'none'"`
+
+	// SentryDSN is where unexpected errors are reported. If it is empty, they are only logged.
+	SentryDSN string `envconfig:"sentry_dsn" secret:"true"`
+	// SentryEnvironment tags reported errors with the environment they happened in.
+	SentryEnvironment string `envconfig:"sentry_environment" default:"production"`
+
+	// StatsCacheTTL is how long stats and report responses are cached for.
+	StatsCacheTTL time.Duration `envconfig:"stats_cache_ttl" default:"30s"`
+
+	// ShareLinkTTL is how long a public share link lasts by default. Clients can ask for a
+	// shorter lifetime, but not a longer one.
+	ShareLinkTTL time.Duration `envconfig:"share_link_ttl" default:"168h"`
+	// ShareRateLimit is how many times a minute a single client IP can view shared todos.
+	// Zero disables the limit.
+	ShareRateLimit int `envconfig:"share_rate_limit" default:"60"`
+
+	// CreateRateLimit is how many todos and share links a single client IP can create an hour,
+	// for deployments open to the public. The two count towards the same limit. Zero (the
+	// default) disables the limit.
+	CreateRateLimit int `envconfig:"create_rate_limit"`
+
+	// InboundEmailToken is the secret part of the URL inbound emails are posted to
+	// (/api/inbound/email/<token>). If it is empty, email ingestion is disabled.
+	InboundEmailToken string `envconfig:"inbound_email_token" secret:"true"`
+	// InboundEmailSigningKey is the mail provider's webhook signing key. If it is set, inbound
+	// emails are only accepted if they are signed with it (see SignatureTolerance).
+	InboundEmailSigningKey string `envconfig:"inbound_email_signing_key" secret:"true"`
+	// InboundEmailMaxSizeMB is the largest inbound email, attachments included, we accept.
+	InboundEmailMaxSizeMB int64 `envconfig:"inbound_email_max_size_mb" default:"25"`
+
+	// IntegrationAPIKey is the key automation platforms like Zapier send in the X-API-Key
+	// header to use the /api/integrations endpoints. If it is empty they are disabled.
+	IntegrationAPIKey string `envconfig:"integration_api_key" secret:"true"`
+	// IntegrationSigningSecret, if set, requires integration actions to be signed with it on
+	// top of the API key, so that a leaked key isn't enough to forge or replay them.
+	IntegrationSigningSecret string `envconfig:"integration_signing_secret" secret:"true"`
+	// SignatureTolerance is how far a signed request's timestamp can be from our clock. Each
+	// signed request is only accepted once within this window, and not at all outside it.
+	SignatureTolerance time.Duration `envconfig:"signature_tolerance" default:"5m"`
+
+	// ContentFilterURL is an external moderation service every new or changed todo is sent to
+	// before it is saved. See the moderation package for what it is sent and must answer.
+	ContentFilterURL string `envconfig:"content_filter_url"`
+	// ContentFilterTimeout is how long we wait for the moderation service. If it doesn't
+	// answer in time the todo is saved but flagged for review.
+	ContentFilterTimeout time.Duration `envconfig:"content_filter_timeout" default:"2s"`
+	// ContentFilterReject and ContentFilterFlag are case-insensitive regular expressions
+	// matched against the title and description of new or changed todos when there is no
+	// moderation service. A match rejects the todo or flags it for review, respectively.
+	ContentFilterReject string `envconfig:"content_filter_reject"`
+	ContentFilterFlag   string `envconfig:"content_filter_flag"`
+
+	// TestFixtures enables the /api/test endpoints, which load fixtures, wipe the database and
+	// control the clock. It must only be turned on in test environments.
+	TestFixtures bool `envconfig:"test_fixtures"`
+
+	// The chaos settings inject faults so that we can check how clients (and the server
+	// itself) cope with failures. They are all off by default and must never be turned on in
+	// production.
+	//
+	// ChaosLatency is a delay added to every request except health checks.
+	ChaosLatency time.Duration `envconfig:"chaos_latency"`
+	// ChaosErrorRate is the fraction of requests, from 0 to 1, that fail with a 500 before
+	// reaching their handler. Health checks never fail.
+	ChaosErrorRate float64 `envconfig:"chaos_error_rate"`
+	// ChaosDBErrorRate is the fraction of database calls, from 0 to 1, that fail as if they
+	// had conflicted with another transaction.
+	ChaosDBErrorRate float64 `envconfig:"chaos_db_error_rate"`
+
+	// RetentionCompletedDays is how many days completed todos are kept before they are purged.
+	// Zero (the default) keeps them forever.
+	RetentionCompletedDays int `envconfig:"retention_completed_days"`
+	// RetentionInterval is how often the purge job runs.
+	RetentionInterval time.Duration `envconfig:"retention_interval" default:"1h"`
+
+	// EventArchiveDays is how many days todo events stay in the todo_events table before the
+	// archive job moves them to todo_events_archive. Zero (the default) never archives them.
+	EventArchiveDays int `envconfig:"event_archive_days"`
+	// EventRetentionDays is how many days archived todo events are kept before they are
+	// deleted, counted from when the event happened. Zero (the default) keeps them forever.
+	// Only archived events are deleted, so this has no effect unless EventArchiveDays is set.
+	EventRetentionDays int `envconfig:"event_retention_days"`
+	// EventArchiveInterval is how often the archive job runs.
+	EventArchiveInterval time.Duration `envconfig:"event_archive_interval" default:"1h"`
+
+	// JobFailureThreshold is how many times in a row a background job can fail before it is
+	// reported. Jobs that miss their schedule are always reported. Zero only reports those.
+	JobFailureThreshold int `envconfig:"job_failure_threshold" default:"3"`
+}
+
+// RetentionCutoff returns the time before which completed todos should be purged, and false if
+// retention is disabled.
+func (c *Config) RetentionCutoff(now time.Time) (time.Time, bool) {
+	if c.RetentionCompletedDays <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -c.RetentionCompletedDays), true
+}
+
+// EventArchiveCutoff returns the time before which todo events should be archived, and false
+// if archiving is disabled.
+func (c *Config) EventArchiveCutoff(now time.Time) (time.Time, bool) {
+	if c.EventArchiveDays <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -c.EventArchiveDays), true
+}
+
+// EventRetentionCutoff returns the time before which archived todo events should be deleted,
+// and false if they are kept forever.
+func (c *Config) EventRetentionCutoff(now time.Time) (time.Time, bool) {
+	if c.EventRetentionDays <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -c.EventRetentionDays), true
 }
 
 // New returns a new Config instance.
@@ -19,5 +240,81 @@ func New() (*Config, error) {
 	if err := envconfig.Process("", &config); err != nil {
 		return nil, err
 	}
+	if err := config.checkSecrets(); err != nil {
+		return nil, err
+	}
+	if _, err := time.LoadLocation(config.Timezone); err != nil {
+		return nil, fmt.Errorf("invalid TIMEZONE: %w", err)
+	}
+	if config.SchemaMismatch != "refuse" && config.SchemaMismatch != "read_only" {
+		return nil, fmt.Errorf("invalid SCHEMA_MISMATCH %q: expected refuse or read_only", config.SchemaMismatch)
+	}
 	return &config, nil
 }
+
+// Location returns the time zone named by Timezone. New checks that it is valid.
+func (c *Config) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Redacted returns a copy of the config with the values of all secret fields hidden. This is
+// what should be used whenever the config is logged or printed.
+func (c Config) Redacted() Config {
+	// Since the receiver isn't a pointer, `c` is already a copy and we can change it freely.
+	//
+	// We use reflection to find the secret fields so that a newly added one is redacted
+	// automatically as long as it has the `secret` tag.
+	v := reflect.ValueOf(&c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if isSecret(v.Type().Field(i)) && field.Kind() == reflect.String && field.String() != "" {
+			field.SetString(redacted)
+		}
+	}
+	return c
+}
+
+// checkSecrets returns an error if the value of a secret field is also used for a field that
+// isn't secret.
+func (c *Config) checkSecrets() error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		secret := v.Field(i)
+		if !isSecret(t.Field(i)) || secret.Kind() != reflect.String || secret.String() == "" {
+			continue
+		}
+		for j := 0; j < t.NumField(); j++ {
+			other := v.Field(j)
+			if isSecret(t.Field(j)) || other.Kind() != reflect.String {
+				continue
+			}
+			if other.String() == secret.String() {
+				// We deliberately leave the value itself out of the error since it is likely
+				// to be logged.
+				return fmt.Errorf("the value of %s appears in %s, which is not secret",
+					envName(t.Field(i)), envName(t.Field(j)))
+			}
+		}
+	}
+	return nil
+}
+
+// isSecret reports whether a field is tagged as secret.
+func isSecret(field reflect.StructField) bool {
+	return field.Tag.Get("secret") == "true"
+}
+
+// envName returns the name of the environment variable for a field.
+func envName(field reflect.StructField) string {
+	return strings.ToUpper(field.Tag.Get("envconfig"))
+}
+
+// OpenLogFile opens a log file at path using the rotation settings in the config.
+func (c *Config) OpenLogFile(path string) (*logging.RotatingFile, error) {
+	return logging.NewRotatingFile(path, int64(c.LogMaxSizeMB)<<20, c.LogMaxAge, c.LogMaxBackups)
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"ls-todo/internal/models"
+)
+
+// Offset pagination gets slower the further into a list you go, since PostgreSQL has to read
+// and throw away every row before the offset. Keyset pagination instead remembers where the
+// last page ended (the values of its sort keys) and asks for the rows after that, which an
+// index can jump straight to however deep the page is.
+//
+// The position is sent to clients as an opaque cursor. They can't build one themselves, which
+// leaves us free to change what's in it.
+
+// keysetFields are the fields lists can be paged through with a cursor, and the columns of
+// each in sort order. The id is added after them to make every position unique.
+var keysetFields = map[string][]string{
+	"created_at": {"created_at"},
+	"due_date":   {"year", "month", "day"},
+}
+
+// Cursor is a position in a list sorted by one of the keyset fields.
+type Cursor struct {
+	// Sort is the order the list is in.
+	Sort SortKey `json:"s"`
+	// Values are the values of the sort columns in the last row of the previous page.
+	Values []string `json:"v"`
+	// ID is the id of the last row of the previous page.
+	ID int64 `json:"i"`
+}
+
+// IsKeysetSort returns whether lists in the given order can be paged through with a cursor.
+// Only a single keyset field can be used.
+func IsKeysetSort(keys []SortKey) bool {
+	if len(keys) != 1 {
+		return false
+	}
+	_, ok := keysetFields[keys[0].Field]
+	return ok
+}
+
+// NextCursor returns the cursor for the page after the one ending with todo, in a list sorted
+// by key. key must be a keyset sort.
+func NextCursor(todo *models.Todo, key SortKey) string {
+	var values []string
+	switch key.Field {
+	case "created_at":
+		values = []string{todo.CreatedAt.Format(time.RFC3339Nano)}
+	case "due_date":
+		values = []string{todo.Year, todo.Month, todo.Day}
+	}
+	data, _ := json.Marshal(Cursor{Sort: key, Values: values, ID: todo.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor returned by NextCursor.
+func ParseCursor(s string) (Cursor, error) {
+	var cursor Cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, fmt.Errorf("%w: invalid cursor", ErrInvalid)
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("%w: invalid cursor", ErrInvalid)
+	}
+	columns, ok := keysetFields[cursor.Sort.Field]
+	if !ok || len(cursor.Values) != len(columns) {
+		return cursor, fmt.Errorf("%w: invalid cursor", ErrInvalid)
+	}
+	return cursor, nil
+}
+
+// seek returns the condition selecting the rows after the cursor's position and the ORDER BY
+// clause that goes with it. The condition's parameters are numbered from first, and args are
+// their values.
+//
+// Comparing rows, as in `(year, month, day, id) > ($4, $5, $6, $7)`, compares column by column
+// like sorting does, so it selects exactly the rows that sort after the position. It only works
+// if every column is sorted in the same direction, which is why the id follows the direction of
+// the sort here rather than always being ascending.
+func (c Cursor) seek(first int) (where, order string, args []interface{}) {
+	columns := append(append([]string{}, keysetFields[c.Sort.Field]...), "id")
+	params := make([]string, len(columns))
+	for i := range columns {
+		params[i] = fmt.Sprintf("$%d", first+i)
+	}
+	for _, value := range c.Values {
+		args = append(args, value)
+	}
+	args = append(args, c.ID)
+
+	comparison := ">"
+	if c.Sort.Desc {
+		comparison = "<"
+	}
+	where = fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), comparison, strings.Join(params, ", "))
+	return where, keysetOrder(c.Sort), args
+}
+
+// keysetOrder returns the ORDER BY clause (without the keywords) of a list sorted by a keyset
+// field: its columns and then the id, all in the key's direction. Every page of such a list
+// has to use it, the first one included. If the first page broke ties by ascending id while
+// later pages used descending, rows that tie on the key would be repeated or skipped.
+//
+// The keyset columns are all NOT NULL, so unlike orderBy we don't need NULLS LAST.
+func keysetOrder(key SortKey) string {
+	columns := append(append([]string{}, keysetFields[key.Field]...), "id")
+	direction := ""
+	if key.Desc {
+		direction = " DESC"
+	}
+	return strings.Join(columns, direction+", ") + direction
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"ls-todo/internal/clock"
+	"ls-todo/internal/models"
+)
+
+func TestParseCursor(t *testing.T) {
+	todo := &models.Todo{ID: 7, Day: "05", Month: "03", Year: "2024",
+		CreatedAt: time.Date(2024, 3, 5, 10, 30, 0, 123456000, time.UTC)}
+	for _, key := range []SortKey{{Field: "due_date"}, {Field: "created_at", Desc: true}} {
+		cursor, err := ParseCursor(NextCursor(todo, key))
+		if err != nil {
+			t.Fatalf("ParseCursor(NextCursor(%+v)): %v", key, err)
+		}
+		if cursor.Sort != key || cursor.ID != todo.ID {
+			t.Errorf("ParseCursor(NextCursor(%+v)) = %+v", key, cursor)
+		}
+	}
+
+	invalid := map[string]string{
+		"not base64":     "!!!",
+		"not json":       base64.RawURLEncoding.EncodeToString([]byte("nope")),
+		"unknown field":  base64.RawURLEncoding.EncodeToString([]byte(`{"s":{"Field":"title"},"v":["a"],"i":1}`)),
+		"missing values": base64.RawURLEncoding.EncodeToString([]byte(`{"s":{"Field":"due_date"},"v":["2024"],"i":1}`)),
+	}
+	for name, s := range invalid {
+		if _, err := ParseCursor(s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: ParseCursor(%q) error = %v, want ErrInvalid", name, s, err)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	tests := []struct {
+		cursor       Cursor
+		where, order string
+	}{
+		{
+			cursor: Cursor{Sort: SortKey{Field: "due_date"}, Values: []string{"2024", "03", "05"}, ID: 7},
+			where:  "(year, month, day, id) > ($4, $5, $6, $7)",
+			order:  "year, month, day, id",
+		},
+		{
+			cursor: Cursor{Sort: SortKey{Field: "created_at", Desc: true}, Values: []string{"2024-03-05T10:30:00Z"}, ID: 7},
+			where:  "(created_at, id) < ($4, $5)",
+			order:  "created_at DESC, id DESC",
+		},
+	}
+	for _, test := range tests {
+		where, order, args := test.cursor.seek(4)
+		if where != test.where || order != test.order {
+			t.Errorf("seek(%+v) = %q, %q, want %q, %q", test.cursor, where, order, test.where, test.order)
+		}
+		if want := len(test.cursor.Values) + 1; len(args) != want {
+			t.Errorf("seek(%+v) returned %d args, want %d", test.cursor, len(args), want)
+		}
+	}
+}
+
+// TestKeysetFirstPageOrder checks that the first page of a keyset sorted list is in the same
+// order as the pages after it, ties included. Otherwise following the next links would repeat
+// some of the rows that tie on the key and skip others.
+func TestKeysetFirstPageOrder(t *testing.T) {
+	for _, key := range []SortKey{
+		{Field: "due_date"}, {Field: "due_date", Desc: true},
+		{Field: "created_at"}, {Field: "created_at", Desc: true},
+	} {
+		_, seekOrder, _ := Cursor{Sort: key, ID: 1}.seek(1)
+		if first := listOrder([]SortKey{key}, "id"); first != seekOrder {
+			t.Errorf("%+v: first page ordered by %q, later pages by %q", key, first, seekOrder)
+		}
+	}
+}
+
+// TestKeysetPagination pages through lists with cursors and checks that every todo comes up
+// exactly once, in the same order as a single query for the whole list. The todos include the
+// edge cases: rows that tie on the sort key (so only the id tells them apart, including across
+// a page boundary), single digit days and months that only sort correctly once padded, and
+// todos without a due date.
+func TestKeysetPagination(t *testing.T) {
+	clk := clock.NewFake()
+	m := testManager(t, clk)
+
+	dates := [][3]string{
+		{"5", "3", "2024"}, {"10", "3", "2024"}, {"05", "03", "2024"}, {"5", "3", "2024"},
+		{"1", "12", "2023"}, {"", "", ""}, {"31", "1", "2025"}, {"", "", ""}, {"9", "10", "2024"},
+	}
+	for _, date := range dates {
+		if _, err := m.CreateTodo(&models.Todo{Title: "todo", Day: date[0], Month: date[1], Year: date[2]}); err != nil {
+			t.Fatalf("CreateTodo: %v", err)
+		}
+	}
+	// All of these share a created_at, so paging by it has to fall back on the id.
+	if _, err := m.db.Exec(`
+		INSERT INTO todos (title, created_at)
+		SELECT 'tied', '2024-01-01T00:00:00Z' FROM generate_series(1, 5)`); err != nil {
+		t.Fatalf("inserting tied todos: %v", err)
+	}
+
+	for _, key := range []SortKey{
+		{Field: "due_date"}, {Field: "due_date", Desc: true},
+		{Field: "created_at"}, {Field: "created_at", Desc: true},
+	} {
+		all, err := m.GetTodos(ListOptions{Sort: []SortKey{key}, Limit: 1000})
+		if err != nil {
+			t.Fatalf("GetTodos(%+v): %v", key, err)
+		}
+
+		var paged []*models.Todo
+		opts := ListOptions{Sort: []SortKey{key}, Limit: 2}
+		for {
+			page, err := m.GetTodos(opts)
+			if err != nil {
+				t.Fatalf("GetTodos(%+v): %v", opts, err)
+			}
+			paged = append(paged, page...)
+			if len(page) < opts.Limit {
+				break
+			}
+			if len(paged) > len(all) {
+				t.Fatalf("%+v: paging returned more todos than the list has", key)
+			}
+			opts.Cursor = NextCursor(page[len(page)-1], key)
+		}
+
+		if !reflect.DeepEqual(ids(paged), ids(all)) {
+			t.Errorf("%+v: paging gave %v, want %v", key, ids(paged), ids(all))
+		}
+	}
+
+	// The padded due dates have to sort in date order.
+	todos, err := m.GetTodos(ListOptions{Sort: []SortKey{{Field: "due_date"}}, Limit: 1000})
+	if err != nil {
+		t.Fatalf("GetTodos: %v", err)
+	}
+	var due []string
+	for _, todo := range todos {
+		if todo.Year != "" {
+			due = append(due, todo.Year+"-"+todo.Month+"-"+todo.Day)
+		}
+	}
+	want := []string{"2023-12-01", "2024-03-05", "2024-03-05", "2024-03-05", "2024-03-10", "2024-10-09", "2025-01-31"}
+	if !reflect.DeepEqual(due, want) {
+		t.Errorf("due dates sorted as %v, want %v", due, want)
+	}
+}
+
+// ids returns the ids of the todos, in order.
+func ids(todos []*models.Todo) []int64 {
+	ids := make([]int64, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+	return ids
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"ls-todo/internal/models"
+)
+
+func (m *pgManager) GetCustomFields() ([]*models.CustomFieldDefinition, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	definitions, err := getCustomFields(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	result := make([]*models.CustomFieldDefinition, 0, len(definitions))
+	for _, definition := range definitions {
+		result = append(result, definition)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (m *pgManager) PutCustomField(definition *models.CustomFieldDefinition) (*models.CustomFieldDefinition, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	options := definition.Options
+	if options == nil {
+		options = []string{}
+	}
+	// `ON CONFLICT ... DO UPDATE` (often called an "upsert") creates the definition if it
+	// doesn't exist and replaces it if it does. The name and type are checked by the table.
+	saved := &models.CustomFieldDefinition{}
+	if err := tx.QueryRowx(`
+		INSERT INTO custom_field_definitions (name, type, options) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET type = EXCLUDED.type, options = EXCLUDED.options
+		RETURNING *`,
+		definition.Name, definition.Type, options).StructScan(saved); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return saved, nil
+}
+
+func (m *pgManager) DeleteCustomField(name string) (*models.CustomFieldDefinition, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := &models.CustomFieldDefinition{}
+	if err := tx.QueryRowx("DELETE FROM custom_field_definitions WHERE name = $1 RETURNING *",
+		name).StructScan(deleted); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+	// The JSONB `-` operator removes a key from an object, so no todo is left with a value
+	// for a field that no longer exists.
+	if _, err := tx.Exec(
+		"UPDATE todos SET custom_fields = custom_fields - $1 WHERE custom_fields ? $1", name); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return deleted, nil
+}
+
+// getCustomFields retrieves all custom field definitions inside the given transaction, keyed
+// by name.
+func getCustomFields(tx *txn) (map[string]*models.CustomFieldDefinition, error) {
+	var definitions []*models.CustomFieldDefinition
+	if err := tx.Select(&definitions, "SELECT * FROM custom_field_definitions"); err != nil {
+		return nil, mapError(err)
+	}
+	byName := make(map[string]*models.CustomFieldDefinition, len(definitions))
+	for _, definition := range definitions {
+		byName[definition.Name] = definition
+	}
+	return byName, nil
+}
+
+// validateCustomFields checks that every value in fields belongs to a defined custom field and
+// has the right type for it.
+func validateCustomFields(tx *txn, fields models.JSONObject) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	definitions, err := getCustomFields(tx)
+	if err != nil {
+		return err
+	}
+	for name, value := range fields {
+		definition, ok := definitions[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown custom field %q", ErrInvalid, name)
+		}
+		if err := definition.Validate(value); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+	return nil
+}
+
+// customFieldFilter turns the custom field filters from ListOptions into a JSON object for use
+// with the `@>` (contains) operator. Filter values always arrive as strings, so we use the
+// field definitions to turn them into the right JSON type; otherwise `{"sprint": "12"}` would
+// never match a number field holding 12.
+func customFieldFilter(tx *txn, filters map[string]string) (models.JSONObject, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	definitions, err := getCustomFields(tx)
+	if err != nil {
+		return nil, err
+	}
+	filter := models.JSONObject{}
+	for name, value := range filters {
+		definition, ok := definitions[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown custom field %q", ErrInvalid, name)
+		}
+		if definition.Type != models.CustomFieldNumber {
+			filter[name] = value
+			continue
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s must be a number", ErrInvalid, name)
+		}
+		filter[name] = n
+	}
+	return filter, nil
+}
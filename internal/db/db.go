@@ -1,44 +1,233 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 
+	"ls-todo/internal/clock"
 	"ls-todo/internal/config"
 	"ls-todo/internal/models"
 )
 
 // PGManager is used for interacting with the PostgreSQL database.
+//
+// Methods that operate on a single todo return a nil todo (and a nil error) when no todo
+// with the given id exists. Database errors are mapped to the errors in errors.go where
+// possible.
 type PGManager interface {
-	// GetTodos retrieves all todos.
-	GetTodos() ([]*models.Todo, error)
-	// GetTodo retrieves a single todo.
+	// GetTodos retrieves a page of todos.
+	GetTodos(opts ListOptions) ([]*models.Todo, error)
+	// GetTodo retrieves a single todo, including its relations.
 	GetTodo(id int64) (*models.Todo, error)
+	// GetTodoAsOf retrieves a todo as it was at the given time, rebuilt from its history.
+	GetTodoAsOf(id int64, asOf time.Time) (*models.Todo, error)
 	// CreateTodo creates a new todo.
 	CreateTodo(todo *models.Todo) (*models.Todo, error)
-	// UpdateTodo update a given todo.
+	// UpdateTodo update a given todo. If the update wouldn't change anything, the todo is
+	// left alone and returned with Unchanged set.
 	UpdateTodo(diff *models.Todo, id int64) (*models.Todo, error)
 	// DeleteTodo deletes a given todo.
 	DeleteTodo(id int64) (*models.Todo, error)
 	// ToggleTodo toggles the completed state of a given todo.
 	ToggleTodo(id int64) (*models.Todo, error)
+	// ToggleStarred toggles the starred state of a given todo.
+	ToggleStarred(id int64) (*models.Todo, error)
+	// GetStarredTodos retrieves a page of the starred todos.
+	GetStarredTodos(opts ListOptions) ([]*models.Todo, error)
+	// GetNewestTodos retrieves a page of todos, newest first.
+	GetNewestTodos(opts ListOptions) ([]*models.Todo, error)
+	// GetRecentlyCompletedTodos retrieves a page of the completed todos, most recently
+	// completed first.
+	GetRecentlyCompletedTodos(opts ListOptions) ([]*models.Todo, error)
+	// CompleteTodo marks a given todo as completed, whether or not it already was.
+	CompleteTodo(id int64) (*models.Todo, error)
+	// GetRelations retrieves the relations of a given todo. It returns nil if the todo
+	// doesn't exist.
+	GetRelations(todoID int64) ([]*models.Relation, error)
+	// CreateRelation creates a relation from a given todo to another. It returns nil if the
+	// todo doesn't exist.
+	CreateRelation(todoID int64, relation *models.Relation) (*models.Relation, error)
+	// DeleteRelation deletes a relation of a given todo. It returns nil if the todo has no
+	// relation with that id.
+	DeleteRelation(todoID, relationID int64) (*models.Relation, error)
+	// GetShares retrieves the public shares of a given todo, including revoked and expired
+	// ones. It returns nil if the todo doesn't exist.
+	GetShares(todoID int64) ([]*models.Share, error)
+	// CreateShare creates a public share of a given todo that lasts until expiresAt. It
+	// returns nil if the todo doesn't exist.
+	CreateShare(todoID int64, expiresAt time.Time) (*models.Share, error)
+	// RevokeShare revokes a public share of a given todo. It returns nil if the todo has no
+	// such share.
+	RevokeShare(todoID, shareID int64) (*models.Share, error)
+	// ViewShare retrieves the todo a public share is for and counts the view. It returns nil
+	// if the share doesn't exist, has expired or has been revoked.
+	ViewShare(token string) (*models.Todo, error)
+	// GetNearbyTodos retrieves the open todos whose location is within its radius of the
+	// given point, nearest first, up to the maximum page size.
+	GetNearbyTodos(latitude, longitude float64) ([]*models.Todo, error)
+	// ClearTodoLocation removes the location of a given todo.
+	ClearTodoLocation(id int64) (*models.Todo, error)
+	// RescheduleTodos shifts the due dates of the given todos by a number of days. Todos that
+	// don't exist or have no due date are left out of the result.
+	RescheduleTodos(ids []int64, days int) ([]*models.Todo, error)
+	// GetPomodoros retrieves the pomodoros of a given todo, oldest first. It returns nil if
+	// the todo doesn't exist.
+	GetPomodoros(todoID int64) ([]*models.Pomodoro, error)
+	// StartPomodoro starts a pomodoro on a given todo. It returns nil if the todo doesn't
+	// exist, and ErrConflict if a pomodoro is already running on it.
+	StartPomodoro(todoID int64) (*models.Pomodoro, error)
+	// CompletePomodoro completes a running pomodoro of a given todo. It returns nil if the
+	// todo has no pomodoro with that id.
+	CompletePomodoro(todoID, pomodoroID int64) (*models.Pomodoro, error)
+	// GetFocusDays retrieves the focus time of each of the last given number of days,
+	// today included, with days starting at midnight in loc.
+	GetFocusDays(days int, loc *time.Location) ([]*models.FocusDay, error)
+	// GetExpiredTodos retrieves the todos that were completed before the given time.
+	GetExpiredTodos(before time.Time) ([]*models.Todo, error)
+	// PurgeExpiredTodos deletes the todos that were completed before the given time and
+	// returns how many were deleted.
+	PurgeExpiredTodos(before time.Time) (int64, error)
+	// ArchiveTodoEvents moves the todo events recorded before the given time into the archive
+	// table, keeping the ones still needed to tell what each todo looks like from then on, and
+	// returns how many were moved.
+	ArchiveTodoEvents(before time.Time) (int64, error)
+	// PurgeArchivedTodoEvents deletes the archived todo events recorded before the given time
+	// and returns how many were deleted.
+	PurgeArchivedTodoEvents(before time.Time) (int64, error)
+	// GetTodoStats retrieves aggregate counts over all todos.
+	GetTodoStats() (*models.TodoStats, error)
+	// CountTodos counts the todos. If completed isn't nil, only todos with that completed
+	// status are counted.
+	CountTodos(completed *bool) (int64, error)
+	// PatchMetadata applies a JSON Merge Patch to the metadata of a given todo.
+	PatchMetadata(id int64, patch map[string]interface{}) (*models.Todo, error)
+	// GetDiagnostics retrieves statistics about the database and its connection pool.
+	GetDiagnostics() (*Diagnostics, error)
+	// GetCustomFields retrieves the custom field definitions.
+	GetCustomFields() ([]*models.CustomFieldDefinition, error)
+	// PutCustomField creates or replaces a custom field definition.
+	PutCustomField(definition *models.CustomFieldDefinition) (*models.CustomFieldDefinition, error)
+	// DeleteCustomField deletes a custom field definition along with every todo's value for
+	// it.
+	DeleteCustomField(name string) (*models.CustomFieldDefinition, error)
+	// ClearTodoFlag clears the content filter's flag on a given todo once an admin has
+	// reviewed it.
+	ClearTodoFlag(id int64) (*models.Todo, error)
+	// GetSchemaVersion retrieves the version of the migrations applied to the database.
+	GetSchemaVersion() (*SchemaVersion, error)
+	// TryJobLock tries to become the one instance that runs the named background job. It
+	// returns true if this instance holds the job's lock, whether it just took it or already
+	// had it. The lock is kept until the instance stops.
+	TryJobLock(job string) (bool, error)
+	// GetJobLeaders retrieves which instances hold the locks of the named jobs. Jobs whose
+	// lock nobody holds are left out.
+	GetJobLeaders(jobs []string) ([]JobLeader, error)
+	// GetListViews retrieves the list views saved by a given client, by name.
+	GetListViews(clientID string) ([]*models.ListView, error)
+	// GetListView retrieves a list view saved by a given client. It returns nil if the client
+	// has no view with that name.
+	GetListView(clientID, name string) (*models.ListView, error)
+	// PutListView creates or replaces a list view.
+	PutListView(view *models.ListView) (*models.ListView, error)
+	// DeleteListView deletes a list view saved by a given client. It returns nil if the
+	// client has no view with that name.
+	DeleteListView(clientID, name string) (*models.ListView, error)
+	// DeleteEverything deletes every todo, custom field and list view and resets the ids,
+	// leaving the database as it was after the migrations ran. It is only meant for test
+	// environments.
+	DeleteEverything() error
+
+	// WithTx calls fn with a PGManager whose methods all run in a single transaction, so that
+	// operations spanning several methods either all happen or none do. The transaction is
+	// committed if fn returns nil and rolled back otherwise.
+	WithTx(ctx context.Context, fn func(tx PGManager) error) error
+}
+
+// ListOptions controls which page of results a list method returns.
+type ListOptions struct {
+	// Limit is the maximum number of results. Zero means the default page size, and anything
+	// above the maximum page size is reduced to it.
+	Limit int
+	// Offset is the number of results to skip.
+	Offset int
+	// CustomFields filters the results to those whose custom fields have the given values.
+	// Only GetTodos and GetStarredTodos support it.
+	CustomFields map[string]string
+	// Sort is the order of the results, most significant key first. If it is empty, each
+	// method uses its own default order.
+	Sort []SortKey
+	// Cursor, if set, is where the page starts instead of Offset, as returned by NextCursor.
+	// The cursor decides the order, so Sort is ignored. Only GetTodos and GetStarredTodos
+	// support it.
+	Cursor string
+	// Relations loads each todo's relations along with it. Only GetTodos and
+	// GetStarredTodos support it.
+	Relations bool
 }
 
 // pgManager implements the PGManager interface for "production".
 type pgManager struct {
 	// db is the database connection.
 	db *sqlx.DB
+	// clock is where we get the current time from. We pass it to queries rather than using
+	// PostgreSQL's `now()` so that tests can control it.
+	clock clock.Clock
+	// tx is the transaction every method runs in when the manager was passed to a WithTx
+	// function. It is nil otherwise.
+	tx *sqlx.Tx
+
+	// defaultPageSize and maxPageSize bound how many rows list methods return. We enforce
+	// these here rather than in the handlers so that no caller can accidentally load an
+	// entire table into memory.
+	defaultPageSize int
+	maxPageSize     int
+
+	// slowQueryThreshold is how long a query can take before it is logged as slow. Zero
+	// turns slow query logging off.
+	slowQueryThreshold time.Duration
+
+	// faultRate is the fraction of calls that fail on purpose, to test how failures are
+	// handled. It is always zero outside of chaos testing.
+	faultRate float64
+
+	// locks are the job locks this instance holds. It is a pointer so that the copies made
+	// by WithTx share it.
+	locks *jobLocks
 }
 
 // New returns a new PGManager instance.
-func New(db *sqlx.DB) PGManager {
-	return &pgManager{db}
+func New(db *sqlx.DB, cfg *config.Config, clk clock.Clock) PGManager {
+	return &pgManager{
+		db:              db,
+		clock:           clk,
+		defaultPageSize: cfg.DefaultPageSize,
+		maxPageSize:     cfg.MaxPageSize,
+
+		slowQueryThreshold: cfg.SlowQueryThreshold,
+		faultRate:          cfg.ChaosDBErrorRate,
+
+		locks: &jobLocks{conns: map[string]*sql.Conn{}},
+	}
 }
 
-func (m *pgManager) GetTodos() ([]*models.Todo, error) {
+func (m *pgManager) GetTodos(opts ListOptions) ([]*models.Todo, error) {
+	// Unless the client asked for a different order, starred todos come first, so that
+	// they're on the first page.
+	return m.listTodos(opts, "TRUE", "starred DESC, id")
+}
+
+// listTodos retrieves a page of the todos matching condition, a fixed SQL condition without
+// parameters. fallback is the order used when opts doesn't have one. All of the list options
+// are supported, so that every list pages, filters and expands the same way.
+func (m *pgManager) listTodos(opts ListOptions, condition, fallback string) ([]*models.Todo, error) {
 	// We open a database transaction.
-	tx, err := m.db.Beginx()
+	tx, err := m.begin()
 	if err != nil {
 		return nil, err
 	}
@@ -48,21 +237,49 @@ func (m *pgManager) GetTodos() ([]*models.Todo, error) {
 	// we want in that case).
 	defer tx.Rollback()
 
-	// Next, we query for all todos in the database.
-	rows, err := tx.Queryx("SELECT * FROM todos ORDER BY id")
+	filter, err := customFieldFilter(tx, opts.CustomFields)
 	if err != nil {
 		return nil, err
 	}
+
+	// Next, we query for the requested page of todos. When there's no filter, `$3 IS NULL` is
+	// true for every row.
+	where, order := "TRUE", listOrder(opts.Sort, fallback)
+	args := []interface{}{m.limit(opts.Limit), opts.Offset, filter}
+	if opts.Cursor != "" {
+		cursor, err := ParseCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		var seekArgs []interface{}
+		where, order, seekArgs = cursor.seek(len(args) + 1)
+		// The cursor replaces the offset.
+		args[1] = 0
+		args = append(args, seekArgs...)
+	}
+	query := `
+		SELECT * FROM todos
+		 WHERE ($3::jsonb IS NULL OR custom_fields @> $3) AND ` + condition + ` AND ` + where + `
+	  ORDER BY ` + order + `
+		 LIMIT $1 OFFSET $2`
+	if opts.Relations {
+		query, args = withRelations(query, order, args)
+	}
+	rows, err := tx.Queryx(query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
 	// We need to close the rows once we're done using them. We use `defer` so this happens
 	// "automatically".
 	defer rows.Close()
 
 	// We create a slice of todos that we will store our results in.
-	var todos []*models.Todo
+	todos := []*models.Todo{}
 	// We iterate over all the returned rows.
 	for rows.Next() {
-		// We create a todo struct that we'll scan the results into.
-		var todo models.Todo
+		// We create a todo struct that we'll scan the results into. It has room for the
+		// relations too, which are only there if they were asked for.
+		var todo todoRow
 		// sqlx provides a StructScan method that will scan the contents of a row into a struct
 		// that models the returned data. This is _very_ useful and is much easier than scanning
 		// each of the individual data points and them assigning them to the fields of a struct.
@@ -72,9 +289,14 @@ func (m *pgManager) GetTodos() ([]*models.Todo, error) {
 		if err := rows.StructScan(&todo); err != nil {
 			return nil, err
 		}
+		if todo.RelationsJSON != nil {
+			if err := json.Unmarshal(todo.RelationsJSON, &todo.Relations); err != nil {
+				return nil, err
+			}
+		}
 		// This is essentially the same as `todos.push(todo)` in JS or Ruby. Again, we need to pass
 		// a pointer since the type of the slice is `[]*models.Todo`.
-		todos = append(todos, &todo)
+		todos = append(todos, &todo.Todo)
 	}
 
 	// Next, we check to see if there were any errors in processing the rows.
@@ -83,14 +305,14 @@ func (m *pgManager) GetTodos() ([]*models.Todo, error) {
 	}
 	// Lastly, we commit the transaction.
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	// We return the slice of todos and a `nil` for the error (since no errors were found).
 	return todos, nil
 }
 
 func (m *pgManager) GetTodo(id int64) (*models.Todo, error) {
-	tx, err := m.db.Beginx()
+	tx, err := m.begin()
 	if err != nil {
 		return nil, err
 	}
@@ -100,45 +322,72 @@ func (m *pgManager) GetTodo(id int64) (*models.Todo, error) {
 	// Here we use `QueryRowx` which can be used when we know there will only be one result.
 	// We then chain the StructScan call.
 	if err := tx.QueryRowx("SELECT * FROM todos WHERE id = $1", id).StructScan(&todo); err != nil {
+		// When no row matches, sqlx gives us `sql.ErrNoRows`. That isn't really a failure, so
+		// we return a nil todo and let the caller decide what to do about it.
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+	relations, err := getRelations(tx, id)
+	if err != nil {
 		return nil, err
 	}
+	todo.Relations = relations
 
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &todo, err
 }
 
 func (m *pgManager) CreateTodo(todo *models.Todo) (*models.Todo, error) {
-	tx, err := m.db.Beginx()
+	tx, err := m.begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
+	// Normalizing here rather than in the handlers means every way of creating a todo (the
+	// API, inbound email, integrations, fixtures) stores it the same way.
+	todo.Normalize()
+	if err := validateCustomFields(tx, todo.CustomFields); err != nil {
+		return nil, err
+	}
+
 	var newTodo models.Todo
 	// Just like JS, we use "``" for templating strings.
 	if err := tx.QueryRowx(`
-        INSERT INTO todos (title, day, month, year, completed, description) VALUES
-			($1, $2, $3, $4, $5, $6) RETURNING *`,
-		todo.Title, todo.Day, todo.Month, todo.Year, todo.Completed, todo.Description,
+        INSERT INTO todos (title, day, month, year, completed, description, starred, completed_at, custom_fields, metadata, flag_reason, latitude, longitude, radius_meters) VALUES
+			($1, $2, $3, $4, $5, $6, $7, CASE WHEN $5 THEN $10::timestamptz END, coalesce($8, '{}'), coalesce($9, '{}'), $11, $12, $13, $14)
+		RETURNING *`,
+		todo.Title, todo.Day, todo.Month, todo.Year, todo.Completed, todo.Description, todo.Starred,
+		todo.CustomFields, todo.Metadata, m.clock.Now(), todo.FlagReason,
+		todo.Latitude, todo.Longitude, todo.RadiusMeters,
 	).StructScan(&newTodo); err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &newTodo, err
 }
 
 func (m *pgManager) UpdateTodo(diff *models.Todo, id int64) (*models.Todo, error) {
-	tx, err := m.db.Beginx()
+	tx, err := m.begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
+	// A field that is only whitespace normalizes to empty, so it is left unchanged below like
+	// one that wasn't sent.
+	diff.Normalize()
+	if err := validateCustomFields(tx, diff.CustomFields); err != nil {
+		return nil, err
+	}
+
 	todo := &models.Todo{}
 	// The following query uses two functions that you probably didn't encounter in the core
 	// curriculum: coalesce and nullif. The first takes any number of arguments and returns
@@ -154,28 +403,83 @@ func (m *pgManager) UpdateTodo(diff *models.Todo, id int64) (*models.Todo, error
 	// false, but we only want to update the field if the user explicitly includes it in the
 	// request body. There's a few ways we could handle this, but for now we'll just require
 	// users to use the ToggleTodo endpoint to change this value.
-	if err := tx.QueryRowx(`
+	//
+	// Custom fields are merged into the existing ones with the JSONB `||` operator, so only
+	// the fields included in the request change. Setting a field to null removes it.
+	//
+	// An update can flag a todo but never clears a flag; only an admin can do that. The
+	// location is replaced only when all of it is sent, so the three fields can't get out of
+	// step; the todos_location_complete constraint rejects a partial one. Leaving all of it
+	// out keeps the location, so removing it is left to ClearTodoLocation.
+	//
+	// The new values are worked out in the `merged` CTE first, so that we can skip the update
+	// when they are the same as the current ones. An update that changes nothing would still
+	// record an event in todo_events, and clients resending a whole todo do that a lot.
+	// `IS DISTINCT FROM` treats two NULLs as equal, which `<>` doesn't. `FOR UPDATE` locks the
+	// row while we compare, so a concurrent update can't slip in between.
+	err = tx.QueryRowx(`
+		WITH merged AS (
+			SELECT id,
+				   coalesce(nullif($2, ''), title) AS title,
+				   coalesce(nullif($3, ''), day) AS day,
+				   coalesce(nullif($4, ''), month) AS month,
+				   coalesce(nullif($5, ''), year) AS year,
+				   coalesce(nullif($6, ''), description) AS description,
+				   jsonb_strip_nulls(custom_fields || coalesce($7, '{}')) AS custom_fields,
+				   coalesce($8, flag_reason) AS flag_reason,
+				   CASE WHEN $9::float8 IS NULL AND $10::float8 IS NULL AND $11::int IS NULL THEN latitude ELSE $9 END AS latitude,
+				   CASE WHEN $9::float8 IS NULL AND $10::float8 IS NULL AND $11::int IS NULL THEN longitude ELSE $10 END AS longitude,
+				   CASE WHEN $9::float8 IS NULL AND $10::float8 IS NULL AND $11::int IS NULL THEN radius_meters ELSE $11 END AS radius_meters
+			  FROM todos
+			 WHERE id = $1
+			   FOR UPDATE
+		)
 		UPDATE todos
 		   SET
-			   title       = coalesce(nullif($2, ''), title),
-			   day 	       = coalesce(nullif($3, ''), day),
-			   month       = coalesce(nullif($4, ''), month),
-			   year        = coalesce(nullif($5, ''), year),
-			   description = coalesce(nullif($6, ''), description)
-		 WHERE id = $1
-	 RETURNING *`,
-		id, diff.Title, diff.Day, diff.Month, diff.Year, diff.Description).StructScan(todo); err != nil {
-		return nil, err
+			   title         = merged.title,
+			   day           = merged.day,
+			   month         = merged.month,
+			   year          = merged.year,
+			   description   = merged.description,
+			   custom_fields = merged.custom_fields,
+			   flag_reason   = merged.flag_reason,
+			   latitude      = merged.latitude,
+			   longitude     = merged.longitude,
+			   radius_meters = merged.radius_meters
+		  FROM merged
+		 WHERE todos.id = merged.id
+		   AND (todos.title, todos.day, todos.month, todos.year, todos.description,
+				todos.custom_fields, todos.flag_reason,
+				todos.latitude, todos.longitude, todos.radius_meters)
+			   IS DISTINCT FROM
+			   (merged.title, merged.day, merged.month, merged.year, merged.description,
+				merged.custom_fields, merged.flag_reason,
+				merged.latitude, merged.longitude, merged.radius_meters)
+	 RETURNING todos.*`,
+		id, diff.Title, diff.Day, diff.Month, diff.Year, diff.Description,
+		diff.CustomFields, diff.FlagReason,
+		diff.Latitude, diff.Longitude, diff.RadiusMeters).StructScan(todo)
+	// No row means either there is no such todo or there was nothing to change, so we look
+	// the todo up to tell which.
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRowx("SELECT * FROM todos WHERE id = $1", id).StructScan(todo)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		todo.Unchanged = true
+	}
+	if err != nil {
+		return nil, mapError(err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return todo, nil
 }
 
 func (m *pgManager) DeleteTodo(id int64) (*models.Todo, error) {
-	tx, err := m.db.Beginx()
+	tx, err := m.begin()
 	if err != nil {
 		return nil, err
 	}
@@ -183,37 +487,194 @@ func (m *pgManager) DeleteTodo(id int64) (*models.Todo, error) {
 
 	todo := &models.Todo{}
 	if err := tx.QueryRowx("DELETE FROM todos WHERE id = $1 RETURNING *", id).StructScan(todo); err != nil {
-		return nil, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return todo, nil
 }
 
 func (m *pgManager) ToggleTodo(id int64) (*models.Todo, error) {
-	tx, err := m.db.Beginx()
+	tx, err := m.begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	var completed bool
-	if err := tx.QueryRowx("SELECT completed FROM todos WHERE id = $1", id).Scan(&completed); err != nil {
+	// We flip the value inside the UPDATE itself rather than reading it first and writing its
+	// opposite. PostgreSQL locks the row while updating it, so a concurrent toggle waits for
+	// this one to finish and then flips the new value -- two toggles always cancel out.
+	todo := &models.Todo{}
+	//
+	// Note that the right-hand side of each assignment sees the row as it was before the
+	// update, so `completed` here is the old value.
+	if err := tx.QueryRowx(`
+		UPDATE todos
+		   SET completed    = NOT completed,
+		       completed_at = CASE WHEN completed THEN NULL ELSE $2::timestamptz END
+		 WHERE id = $1
+	 RETURNING *`,
+		id, m.clock.Now()).StructScan(todo); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return todo, nil
+}
+
+func (m *pgManager) ToggleStarred(id int64) (*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
+	// Like ToggleTodo, we flip the value in a single statement so concurrent toggles can't
+	// both read the same value.
 	todo := &models.Todo{}
-	if err := tx.QueryRowx("UPDATE todos SET completed = $1 WHERE id = $2 RETURNING *",
-		!completed, id).StructScan(todo); err != nil {
+	if err := tx.QueryRowx("UPDATE todos SET starred = NOT starred WHERE id = $1 RETURNING *",
+		id).StructScan(todo); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return todo, nil
+}
+
+func (m *pgManager) GetStarredTodos(opts ListOptions) ([]*models.Todo, error) {
+	return m.listTodos(opts, "starred", "id")
+}
+
+func (m *pgManager) PatchMetadata(id int64, patch map[string]interface{}) (*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	// PostgreSQL's `||` only merges the top level of an object, but a merge patch is applied
+	// recursively. So we read the metadata, patch it here and write it back, locking the row
+	// so that a concurrent patch can't be lost in between.
+	todo, err := lockTodo(tx, id)
+	if err != nil || todo == nil {
+		return nil, err
+	}
+
+	updated := &models.Todo{}
+	if err := tx.QueryRowx("UPDATE todos SET metadata = $2 WHERE id = $1 RETURNING *",
+		id, todo.Metadata.MergePatch(patch)).StructScan(updated); err != nil {
+		return nil, mapError(err)
+	}
 
 	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return updated, nil
+}
+
+func (m *pgManager) GetExpiredTodos(before time.Time) ([]*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
 		return nil, err
 	}
-	return todo, nil
+	defer tx.Rollback()
+
+	// `Select` is a shortcut sqlx gives us for the query/iterate/StructScan loop we wrote out
+	// by hand in GetTodos.
+	todos := []*models.Todo{}
+	if err := tx.Select(&todos, `
+		SELECT * FROM todos
+		 WHERE completed AND completed_at < $1
+	  ORDER BY completed_at, id
+		 LIMIT $2`, before, m.maxPageSize); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return todos, nil
+}
+
+func (m *pgManager) PurgeExpiredTodos(before time.Time) (int64, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM todos WHERE completed AND completed_at < $1", before)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, mapError(err)
+	}
+	return purged, nil
+}
+
+func (m *pgManager) GetTodoStats() (*models.TodoStats, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// `FILTER` lets us count different subsets of the rows in a single pass over the table.
+	stats := &models.TodoStats{}
+	if err := tx.QueryRowx(`
+		SELECT count(*)                              AS total,
+		       count(*) FILTER (WHERE completed)     AS completed,
+		       count(*) FILTER (WHERE NOT completed) AS open
+		  FROM todos`).StructScan(stats); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return stats, nil
+}
+
+func (m *pgManager) CountTodos(completed *bool) (int64, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// A nil pointer is sent to the database as NULL, so `$1 IS NULL` lets us make the filter
+	// optional without building a different query.
+	var count int64
+	if err := tx.Get(&count,
+		"SELECT count(*) FROM todos WHERE $1::bool IS NULL OR completed = $1", completed); err != nil {
+		return 0, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, mapError(err)
+	}
+	return count, nil
 }
 
 //////////////////////////////////////////////////////////////////////////////////////////
@@ -221,9 +682,23 @@ func (m *pgManager) ToggleTodo(id int64) (*models.Todo, error) {
 
 // GetConnString returns the connection string for connecting to a PostgreSQL database.
 func GetConnString(cfg *config.Config) string {
+	return connString(cfg, cfg.PGHost)
+}
+
+// GetReplicaConnString returns the connection string for connecting to the read replica of the
+// PostgreSQL database. If no replica is configured, it connects to the primary instead.
+func GetReplicaConnString(cfg *config.Config) string {
+	if cfg.PGReplicaHost == "" {
+		return GetConnString(cfg)
+	}
+	return connString(cfg, cfg.PGReplicaHost)
+}
+
+// connString builds a connection string for the given host using the credentials in cfg.
+func connString(cfg *config.Config, host string) string {
 	return fmt.Sprintf(
 		"host=%s user=%s dbname=%s port=%d sslmode=%v password=%s",
-		cfg.PGHost,
+		host,
 		cfg.PGUser,
 		cfg.PGDatabase,
 		cfg.PGPort,
@@ -231,3 +706,61 @@ func GetConnString(cfg *config.Config) string {
 		cfg.PGPassword,
 	)
 }
+
+func (m *pgManager) DeleteEverything() error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// TRUNCATE is much faster than DELETE and, with RESTART IDENTITY, starts the ids from 1
+	// again so tests see the same ids every run. It doesn't fire the todo_events trigger, so
+	// we truncate the history too. Every table with a foreign key to todos has to be in the
+	// list, since PostgreSQL won't truncate a table that another one still references.
+	if _, err := tx.Exec(`
+		TRUNCATE todos, todo_relations, todo_shares, todo_pomodoros, todo_events,
+		         todo_events_archive, custom_field_definitions, list_views
+		RESTART IDENTITY`); err != nil {
+		return mapError(err)
+	}
+
+	return mapError(tx.Commit())
+}
+
+// todoExists reports whether a todo with the given id exists. Methods that list things
+// belonging to a todo use it to tell a todo with none apart from a todo that doesn't exist.
+func todoExists(tx *txn, id int64) (bool, error) {
+	var exists bool
+	if err := tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1)", id); err != nil {
+		return false, mapError(err)
+	}
+	return exists, nil
+}
+
+// lockTodo retrieves a todo inside the given transaction using `SELECT ... FOR UPDATE`. This
+// locks the row until the transaction ends, so any other transaction trying to change (or
+// lock) it has to wait. Use it for read-modify-write operations that can't be expressed as a
+// single statement. It returns a nil todo if none exists with the given id.
+func lockTodo(tx *txn, id int64) (*models.Todo, error) {
+	todo := &models.Todo{}
+	if err := tx.QueryRowx("SELECT * FROM todos WHERE id = $1 FOR UPDATE", id).StructScan(todo); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+	return todo, nil
+}
+
+// limit returns the number of rows a list method should return when the caller asked for
+// requested.
+func (m *pgManager) limit(requested int) int {
+	if requested <= 0 {
+		return m.defaultPageSize
+	}
+	if requested > m.maxPageSize {
+		return m.maxPageSize
+	}
+	return requested
+}
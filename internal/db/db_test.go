@@ -0,0 +1,34 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"ls-todo/internal/clock"
+	"ls-todo/internal/config"
+)
+
+// testManager returns a manager for the database named by TEST_DATABASE_URL (a libpq
+// connection string), with all of its data deleted. The migrations have to have been applied
+// to it already. Tests that need a database are skipped when the variable isn't set, so that
+// `go test ./...` still works without one.
+func testManager(tb testing.TB, clk clock.Clock) *pgManager {
+	tb.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		tb.Skip("TEST_DATABASE_URL is not set")
+	}
+	conn, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		tb.Fatalf("connecting to the test database: %v", err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+
+	m := New(conn, &config.Config{DefaultPageSize: 100, MaxPageSize: 1000}, clk).(*pgManager)
+	if err := m.DeleteEverything(); err != nil {
+		tb.Fatalf("emptying the test database: %v", err)
+	}
+	return m
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"ls-todo/internal/models"
+)
+
+// dedupManager wraps a PGManager so that identical reads that happen at the same time share a
+// single database query. When the UI fires several `GET /api/todos` requests at once, only the
+// first one reaches the database; the rest wait for it and get a copy of its result.
+//
+// Embedding the PGManager means every method we don't override here is passed straight
+// through to the wrapped manager.
+type dedupManager struct {
+	PGManager
+
+	group singleflight.Group
+	// generation is part of every key and goes up each time a write finishes. A read that
+	// starts after a write therefore never joins a query that started before it, which could
+	// return the data as it was before the write. Without this, a client that saves a todo
+	// and then reloads the list could be shown the list without its change.
+	generation atomic.Uint64
+}
+
+// Deduplicate returns a PGManager that deduplicates concurrent identical reads made through m.
+func Deduplicate(m PGManager) PGManager {
+	return &dedupManager{PGManager: m}
+}
+
+func (m *dedupManager) GetTodos(opts ListOptions) ([]*models.Todo, error) {
+	// The key has to include everything that affects the result, otherwise two different
+	// pages would be treated as the same query.
+	key := fmt.Sprintf("%d:todos:%+v", m.generation.Load(), opts)
+	v, err, shared := m.group.Do(key, func() (interface{}, error) {
+		return m.PGManager.GetTodos(opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	todos := v.([]*models.Todo)
+	if shared {
+		todos = cloneTodos(todos)
+	}
+	return todos, nil
+}
+
+func (m *dedupManager) GetTodo(id int64) (*models.Todo, error) {
+	key := fmt.Sprintf("%d:todo:%s", m.generation.Load(), strconv.FormatInt(id, 10))
+	v, err, shared := m.group.Do(key, func() (interface{}, error) {
+		return m.PGManager.GetTodo(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	todo := v.(*models.Todo)
+	if shared && todo != nil {
+		todo = cloneTodo(todo)
+	}
+	return todo, nil
+}
+
+// wrote is deferred by every method that changes todos, so that reads made after it returns
+// start a query of their own.
+func (m *dedupManager) wrote() {
+	m.generation.Add(1)
+}
+
+func (m *dedupManager) CreateTodo(todo *models.Todo) (*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.CreateTodo(todo)
+}
+
+func (m *dedupManager) UpdateTodo(diff *models.Todo, id int64) (*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.UpdateTodo(diff, id)
+}
+
+func (m *dedupManager) DeleteTodo(id int64) (*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.DeleteTodo(id)
+}
+
+func (m *dedupManager) ToggleTodo(id int64) (*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.ToggleTodo(id)
+}
+
+func (m *dedupManager) ToggleStarred(id int64) (*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.ToggleStarred(id)
+}
+
+func (m *dedupManager) CompleteTodo(id int64) (*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.CompleteTodo(id)
+}
+
+func (m *dedupManager) CreateRelation(todoID int64, relation *models.Relation) (*models.Relation, error) {
+	defer m.wrote()
+	return m.PGManager.CreateRelation(todoID, relation)
+}
+
+func (m *dedupManager) DeleteRelation(todoID, relationID int64) (*models.Relation, error) {
+	defer m.wrote()
+	return m.PGManager.DeleteRelation(todoID, relationID)
+}
+
+func (m *dedupManager) ClearTodoLocation(id int64) (*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.ClearTodoLocation(id)
+}
+
+func (m *dedupManager) RescheduleTodos(ids []int64, days int) ([]*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.RescheduleTodos(ids, days)
+}
+
+func (m *dedupManager) PurgeExpiredTodos(before time.Time) (int64, error) {
+	defer m.wrote()
+	return m.PGManager.PurgeExpiredTodos(before)
+}
+
+func (m *dedupManager) PatchMetadata(id int64, patch map[string]interface{}) (*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.PatchMetadata(id, patch)
+}
+
+func (m *dedupManager) PutCustomField(definition *models.CustomFieldDefinition) (*models.CustomFieldDefinition, error) {
+	defer m.wrote()
+	return m.PGManager.PutCustomField(definition)
+}
+
+func (m *dedupManager) DeleteCustomField(name string) (*models.CustomFieldDefinition, error) {
+	defer m.wrote()
+	return m.PGManager.DeleteCustomField(name)
+}
+
+func (m *dedupManager) ClearTodoFlag(id int64) (*models.Todo, error) {
+	defer m.wrote()
+	return m.PGManager.ClearTodoFlag(id)
+}
+
+func (m *dedupManager) DeleteEverything() error {
+	defer m.wrote()
+	return m.PGManager.DeleteEverything()
+}
+
+func (m *dedupManager) WithTx(ctx context.Context, fn func(tx PGManager) error) error {
+	// The PGManager fn gets runs its methods on the wrapped manager directly, so we can't
+	// tell which of them write; we assume the transaction did.
+	defer m.wrote()
+	return m.PGManager.WithTx(ctx, fn)
+}
+
+// cloneTodos copies a slice of todos. When a result is shared between callers, each gets its
+// own copy so that one of them changing a todo can't affect the others.
+func cloneTodos(todos []*models.Todo) []*models.Todo {
+	clones := make([]*models.Todo, len(todos))
+	for i, todo := range todos {
+		clones[i] = cloneTodo(todo)
+	}
+	return clones
+}
+
+// cloneTodo copies a todo along with everything it points to, so that nothing is shared
+// between the copy and the original.
+func cloneTodo(todo *models.Todo) *models.Todo {
+	clone := *todo
+	clone.DueDate = clonePointer(todo.DueDate)
+	clone.CompletedAt = clonePointer(todo.CompletedAt)
+	clone.Latitude = clonePointer(todo.Latitude)
+	clone.Longitude = clonePointer(todo.Longitude)
+	clone.RadiusMeters = clonePointer(todo.RadiusMeters)
+	clone.FlagReason = clonePointer(todo.FlagReason)
+	clone.DaysUntilDue = clonePointer(todo.DaysUntilDue)
+	clone.CustomFields = cloneJSONObject(todo.CustomFields)
+	clone.Metadata = cloneJSONObject(todo.Metadata)
+	if todo.Relations != nil {
+		clone.Relations = make([]*models.Relation, len(todo.Relations))
+		for i, relation := range todo.Relations {
+			clone.Relations[i] = clonePointer(relation)
+		}
+	}
+	return &clone
+}
+
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func cloneJSONObject(o models.JSONObject) models.JSONObject {
+	if o == nil {
+		return nil
+	}
+	return models.JSONObject(cloneJSON(map[string]interface{}(o)).(map[string]interface{}))
+}
+
+// cloneJSON copies a decoded JSON value. Objects and arrays are copied all the way down; the
+// other kinds of value are immutable, so they can be shared.
+func cloneJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			clone[key] = cloneJSON(value)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, value := range v {
+			clone[i] = cloneJSON(value)
+		}
+		return clone
+	default:
+		return v
+	}
+}
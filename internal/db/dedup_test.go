@@ -0,0 +1,89 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"ls-todo/internal/models"
+)
+
+// blockingManager is a PGManager whose GetTodos waits to be released, so that a test can
+// control which reads are in flight at the same time.
+type blockingManager struct {
+	PGManager
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingManager) GetTodos(opts ListOptions) ([]*models.Todo, error) {
+	m.started <- struct{}{}
+	<-m.release
+	return []*models.Todo{{ID: 1}}, nil
+}
+
+func (m *blockingManager) UpdateTodo(diff *models.Todo, id int64) (*models.Todo, error) {
+	return diff, nil
+}
+
+func TestDedupSkipsReadsStartedBeforeAWrite(t *testing.T) {
+	inner := &blockingManager{started: make(chan struct{}), release: make(chan struct{})}
+	m := Deduplicate(inner)
+
+	done := make(chan struct{})
+	read := func() {
+		if _, err := m.GetTodos(ListOptions{}); err != nil {
+			t.Errorf("GetTodos: %v", err)
+		}
+		done <- struct{}{}
+	}
+	go read()
+	<-inner.started
+
+	if _, err := m.UpdateTodo(&models.Todo{ID: 1}, 1); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+
+	// The read that was in flight during the update may not see it, so the next one has to
+	// query the database again rather than join it.
+	go read()
+	select {
+	case <-inner.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a read made after a write joined a read started before it")
+	}
+	close(inner.release)
+	<-done
+	<-done
+}
+
+func TestCloneTodo(t *testing.T) {
+	lat, reason := 1.5, "spam"
+	todo := &models.Todo{
+		ID:           1,
+		Latitude:     &lat,
+		FlagReason:   &reason,
+		CustomFields: models.JSONObject{"owner": "ann", "tags": []interface{}{"a"}},
+		Metadata:     models.JSONObject{"nested": map[string]interface{}{"n": 1.0}},
+		Relations:    []*models.Relation{{ID: 2, Kind: models.RelationRelated, TodoID: 3}},
+	}
+	clone := cloneTodo(todo)
+	if !reflect.DeepEqual(clone, todo) {
+		t.Fatalf("cloneTodo(%+v) = %+v", todo, clone)
+	}
+
+	*clone.Latitude = 2
+	*clone.FlagReason = "ok"
+	clone.CustomFields["owner"] = "bob"
+	clone.CustomFields["tags"].([]interface{})[0] = "b"
+	clone.Metadata["nested"].(map[string]interface{})["n"] = 2.0
+	clone.Relations[0].Kind = models.RelationDuplicateOf
+
+	if lat != 1.5 || reason != "spam" || todo.CustomFields["owner"] != "ann" ||
+		todo.CustomFields["tags"].([]interface{})[0] != "a" ||
+		todo.Metadata["nested"].(map[string]interface{})["n"] != 1.0 ||
+		todo.Relations[0].Kind != models.RelationRelated {
+		t.Errorf("changing the clone changed the original: %+v", todo)
+	}
+}
@@ -0,0 +1,143 @@
+package db
+
+import "time"
+
+// maxTransactions is how many of the longest-running transactions GetDiagnostics returns.
+const maxTransactions = 5
+
+// Diagnostics is a snapshot of the database's health, taken from the connection pool and
+// PostgreSQL's statistics views. It lets operators see what the database is doing without
+// having to connect to it.
+type Diagnostics struct {
+	Pool                PoolStats          `json:"pool"`
+	LongestTransactions []TransactionStats `json:"longest_transactions"`
+	Tables              []TableStats       `json:"tables"`
+	Indexes             []IndexStats       `json:"indexes"`
+	// TodoEvents describes the todo history tables, so operators can check that archiving
+	// keeps the live one small.
+	TodoEvents []EventTableStats `json:"todo_events"`
+}
+
+// PoolStats describes the connections in our pool. See sql.DBStats for what each one means.
+type PoolStats struct {
+	MaxOpen      int     `json:"max_open"`
+	Open         int     `json:"open"`
+	InUse        int     `json:"in_use"`
+	Idle         int     `json:"idle"`
+	WaitCount    int64   `json:"wait_count"`
+	WaitSeconds  float64 `json:"wait_seconds"`
+	MaxIdleClose int64   `json:"max_idle_closed"`
+}
+
+// TransactionStats describes a transaction that is open in the database.
+type TransactionStats struct {
+	PID             int     `json:"pid" db:"pid"`
+	State           string  `json:"state" db:"state"`
+	DurationSeconds float64 `json:"duration_seconds" db:"duration_seconds"`
+	// Query is the start of the statement the transaction is running, or ran last.
+	Query string `json:"query" db:"query"`
+}
+
+// TableStats describes one of our tables.
+type TableStats struct {
+	Name     string `json:"name" db:"name"`
+	LiveRows int64  `json:"live_rows" db:"live_rows"`
+	// DeadRows are rows that have been deleted or updated but not vacuumed away yet. A lot of
+	// them compared to LiveRows means the table is bloated.
+	DeadRows       int64      `json:"dead_rows" db:"dead_rows"`
+	TotalBytes     int64      `json:"total_bytes" db:"total_bytes"`
+	LastAutovacuum *time.Time `json:"last_autovacuum" db:"last_autovacuum"`
+}
+
+// EventTableStats describes one of the tables holding todo events: todo_events or its archive.
+type EventTableStats struct {
+	Name string `json:"name" db:"name"`
+	// Rows is PostgreSQL's estimate, which is much cheaper than counting a big table.
+	Rows       int64      `json:"rows" db:"rows"`
+	TotalBytes int64      `json:"total_bytes" db:"total_bytes"`
+	Oldest     *time.Time `json:"oldest" db:"oldest"`
+}
+
+// IndexStats describes one of our indexes.
+type IndexStats struct {
+	Table string `json:"table" db:"table_name"`
+	Name  string `json:"name" db:"name"`
+	// Scans is how many times the index has been used. An index that is never used only
+	// slows down writes.
+	Scans     int64 `json:"scans" db:"scans"`
+	SizeBytes int64 `json:"size_bytes" db:"size_bytes"`
+}
+
+func (m *pgManager) GetDiagnostics() (*Diagnostics, error) {
+	stats := m.db.Stats()
+	diagnostics := &Diagnostics{
+		Pool: PoolStats{
+			MaxOpen:      stats.MaxOpenConnections,
+			Open:         stats.OpenConnections,
+			InUse:        stats.InUse,
+			Idle:         stats.Idle,
+			WaitCount:    stats.WaitCount,
+			WaitSeconds:  stats.WaitDuration.Seconds(),
+			MaxIdleClose: stats.MaxIdleClosed,
+		},
+		LongestTransactions: []TransactionStats{},
+		Tables:              []TableStats{},
+		Indexes:             []IndexStats{},
+		TodoEvents:          []EventTableStats{},
+	}
+
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// We leave out our own connection, which is always in a transaction while this runs.
+	if err := tx.Select(&diagnostics.LongestTransactions, `
+		SELECT pid, coalesce(state, '') AS state,
+		       extract(epoch FROM now() - xact_start)::float8 AS duration_seconds,
+		       left(query, 200) AS query
+		  FROM pg_stat_activity
+		 WHERE datname = current_database() AND xact_start IS NOT NULL AND pid <> pg_backend_pid()
+	  ORDER BY xact_start
+		 LIMIT $1`, maxTransactions); err != nil {
+		return nil, mapError(err)
+	}
+	if err := tx.Select(&diagnostics.Tables, `
+		SELECT relname AS name, n_live_tup AS live_rows, n_dead_tup AS dead_rows,
+		       pg_total_relation_size(relid) AS total_bytes, last_autovacuum
+		  FROM pg_stat_user_tables
+		 WHERE schemaname = current_schema()
+	  ORDER BY relname`); err != nil {
+		return nil, mapError(err)
+	}
+	if err := tx.Select(&diagnostics.Indexes, `
+		SELECT relname AS table_name, indexrelname AS name, idx_scan AS scans,
+		       pg_relation_size(indexrelid) AS size_bytes
+		  FROM pg_stat_user_indexes
+		 WHERE schemaname = current_schema()
+	  ORDER BY relname, indexrelname`); err != nil {
+		return nil, mapError(err)
+	}
+
+	// Events are created in id order, so the oldest one in todo_events can be found from the
+	// primary key. The archive has an index on created_at. Either way it is cheap however big
+	// the tables get.
+	if err := tx.Select(&diagnostics.TodoEvents, `
+		SELECT 'todo_events' AS name, greatest(reltuples, 0)::bigint AS rows,
+		       pg_total_relation_size(oid) AS total_bytes,
+		       (SELECT created_at FROM todo_events ORDER BY id LIMIT 1) AS oldest
+		  FROM pg_class WHERE oid = 'todo_events'::regclass
+		UNION ALL
+		SELECT 'todo_events_archive', greatest(reltuples, 0)::bigint,
+		       pg_total_relation_size(oid),
+		       (SELECT min(created_at) FROM todo_events_archive)
+		  FROM pg_class WHERE oid = 'todo_events_archive'::regclass`); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return diagnostics, nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/lib/pq"
+)
+
+// These are the errors the PGManager can return that callers may want to handle specially.
+// Anything else should be treated as an unexpected database failure.
+//
+// The errors returned by PGManager methods wrap one of these, so callers should compare
+// them using `errors.Is` rather than `==`.
+var (
+	// ErrConflict is returned when a write would violate a unique constraint.
+	ErrConflict = errors.New("conflicting record")
+	// ErrInvalid is returned when a write would violate a foreign key, check or not-null
+	// constraint, i.e. the data itself is unacceptable.
+	ErrInvalid = errors.New("invalid record")
+	// ErrRetryable is returned when the transaction could not be serialized with a
+	// concurrent one. The operation is safe to try again.
+	ErrRetryable = errors.New("transaction conflict, try again")
+)
+
+// mapError translates the errors we get back from PostgreSQL into one of the errors above.
+// Errors we don't know how to classify are returned as-is.
+func mapError(err error) error {
+	// `errors.As` walks the chain of wrapped errors looking for one that matches the type of
+	// the target. If it finds one, it assigns it to `pqErr` for us.
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch string(pqErr.Code) {
+	case pgerrcode.UniqueViolation:
+		return fmt.Errorf("%w: %s", ErrConflict, pqErr.Message)
+	case pgerrcode.ForeignKeyViolation, pgerrcode.CheckViolation, pgerrcode.NotNullViolation:
+		return fmt.Errorf("%w: %s", ErrInvalid, pqErr.Message)
+	case pgerrcode.SerializationFailure, pgerrcode.DeadlockDetected:
+		return fmt.Errorf("%w: %s", ErrRetryable, pqErr.Message)
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"ls-todo/internal/models"
+)
+
+// todoEvent is a row of the todo_events table, which a trigger fills in on every change to a
+// todo.
+type todoEvent struct {
+	Kind  string `db:"kind"`
+	State []byte `db:"state"`
+}
+
+func (m *pgManager) GetTodoAsOf(id int64, asOf time.Time) (*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Each event holds the whole todo as it was after the change, so replaying the events up
+	// to a point in time comes down to taking the last one. We order by id rather than time
+	// since every event in a transaction gets the same timestamp.
+	//
+	// Old events may have been moved to the archive, which keeps their ids, so we look in both
+	// tables. ArchiveTodoEvents never archives the last event before a point, so for recent
+	// times the archive has nothing to add, but it is cheap to check by its index.
+	var event todoEvent
+	if err := tx.QueryRowx(`
+		SELECT kind, state
+		  FROM (SELECT id, kind, state FROM todo_events
+		         WHERE todo_id = $1 AND created_at <= $2
+		         UNION ALL
+		        SELECT id, kind, state FROM todo_events_archive
+		         WHERE todo_id = $1 AND created_at <= $2) AS events
+	  ORDER BY id DESC
+		 LIMIT 1`, id, asOf).StructScan(&event); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+	// A todo that had been deleted by then didn't exist, the same as one not yet created.
+	if event.Kind == "deleted" {
+		return nil, nil
+	}
+
+	// The trigger stores the row with `to_jsonb`, which uses the column names as keys. These
+	// match the todo's JSON tags, so we can decode it straight into the model.
+	var todo models.Todo
+	if err := json.Unmarshal(event.State, &todo); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return &todo, nil
+}
+
+// archiveBatchSize is how many events ArchiveTodoEvents moves per transaction. Moving them in
+// batches keeps each transaction (and the locks it holds) short, however far behind the
+// archive is.
+const archiveBatchSize = 10000
+
+func (m *pgManager) ArchiveTodoEvents(before time.Time) (int64, error) {
+	var archived int64
+	for {
+		moved, err := m.archiveTodoEventBatch(before)
+		if err != nil {
+			return archived, err
+		}
+		archived += moved
+		if moved < archiveBatchSize {
+			return archived, nil
+		}
+	}
+}
+
+// archiveTodoEventBatch moves up to archiveBatchSize events recorded before the given time into
+// the archive and returns how many it moved.
+func (m *pgManager) archiveTodoEventBatch(before time.Time) (int64, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// GetTodoAsOf answers with the last event at or before a given time, so to answer for any
+	// time after the cutoff from todo_events alone we have to keep each todo's last event
+	// before it. An event can go once there is a newer one before the cutoff, or if it is a
+	// deletion, since a todo with no events is treated the same as a deleted one.
+	//
+	// `DELETE ... RETURNING` inside a CTE lets us delete and insert the same rows in one
+	// statement.
+	res, err := tx.Exec(`
+		WITH moved AS (
+			DELETE FROM todo_events
+			 WHERE id IN (
+				SELECT e.id
+				  FROM todo_events e
+				 WHERE e.created_at < $1
+				   AND (e.kind = 'deleted' OR EXISTS (
+						SELECT 1 FROM todo_events newer
+						 WHERE newer.todo_id = e.todo_id AND newer.id > e.id AND newer.created_at < $1))
+			  ORDER BY e.id
+				 LIMIT $2)
+		 RETURNING id, todo_id, kind, state, created_at
+		)
+		INSERT INTO todo_events_archive (id, todo_id, kind, state, created_at)
+		SELECT id, todo_id, kind, state, created_at FROM moved`, before, archiveBatchSize)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	moved, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, mapError(err)
+	}
+	return moved, nil
+}
+
+func (m *pgManager) PurgeArchivedTodoEvents(before time.Time) (int64, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM todo_events_archive WHERE created_at < $1", before)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, mapError(err)
+	}
+	return purged, nil
+}
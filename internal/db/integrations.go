@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"ls-todo/internal/models"
+)
+
+func (m *pgManager) GetNewestTodos(opts ListOptions) ([]*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Ids are handed out in increasing order, so the highest ids are the newest todos.
+	todos := []*models.Todo{}
+	if err := tx.Select(&todos, "SELECT * FROM todos ORDER BY id DESC LIMIT $1 OFFSET $2",
+		m.limit(opts.Limit), opts.Offset); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return todos, nil
+}
+
+func (m *pgManager) GetRecentlyCompletedTodos(opts ListOptions) ([]*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	todos := []*models.Todo{}
+	if err := tx.Select(&todos, `
+		SELECT * FROM todos
+		 WHERE completed
+	  ORDER BY completed_at DESC NULLS LAST, id DESC
+		 LIMIT $1 OFFSET $2`,
+		m.limit(opts.Limit), opts.Offset); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return todos, nil
+}
+
+func (m *pgManager) CompleteTodo(id int64) (*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Unlike ToggleTodo, completing a todo twice leaves it completed. A todo that already was
+	// keeps the time it was completed.
+	todo := &models.Todo{}
+	if err := tx.QueryRowx(`
+		UPDATE todos
+		   SET completed    = true,
+		       completed_at = CASE WHEN completed THEN completed_at ELSE $2::timestamptz END
+		 WHERE id = $1
+	 RETURNING *`,
+		id, m.clock.Now()).StructScan(todo); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return todo, nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"ls-todo/internal/models"
+)
+
+const (
+	// maxReminderRadius is the largest radius a todo's location can have, in meters. It has
+	// to match the check on todos.radius_meters.
+	maxReminderRadius = 50000
+	// metersPerDegree is roughly how many meters there are in a degree of latitude.
+	metersPerDegree = 111320
+)
+
+func (m *pgManager) GetNearbyTodos(latitude, longitude float64) ([]*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// No todo can be further away in latitude than the largest radius allows, so that check
+	// lets the todos_latitude index rule out most of them. The exact distance is then worked
+	// out with the haversine formula, which treats the Earth as a sphere; that is accurate to
+	// well under a percent, plenty for "you're near the shop".
+	//
+	// The distance is worked out in a LATERAL subquery so we can filter and sort on it
+	// without it becoming a column of the result, which StructScan would have nowhere to put.
+	// Rounding can push the value under the square root just over 1, which asin rejects, so
+	// we cap it.
+	//
+	// Like the lists, the result is capped at the maximum page size. Only the nearest todos
+	// are worth a reminder anyway.
+	todos := []*models.Todo{}
+	if err := tx.Select(&todos, `
+		SELECT todos.*
+		  FROM todos,
+		       LATERAL (SELECT 2 * 6371000 * asin(least(1, sqrt(
+		                    power(sin(radians(latitude - $1) / 2), 2) +
+		                    cos(radians($1)) * cos(radians(latitude)) *
+		                    power(sin(radians(longitude - $2) / 2), 2)))) AS meters) AS distance
+		 WHERE NOT completed
+		   AND latitude BETWEEN $1 - $3 AND $1 + $3
+		   AND distance.meters <= radius_meters
+	  ORDER BY distance.meters, id
+		 LIMIT $4`,
+		latitude, longitude, float64(maxReminderRadius)/metersPerDegree, m.maxPageSize); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return todos, nil
+}
+
+func (m *pgManager) ClearTodoLocation(id int64) (*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	todo := &models.Todo{}
+	if err := tx.QueryRowx(`
+		UPDATE todos SET latitude = NULL, longitude = NULL, radius_meters = NULL
+		 WHERE id = $1
+		RETURNING *`, id).StructScan(todo); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return todo, nil
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+)
+
+// jobLockClass is the first half of the key of every job lock. PostgreSQL advisory locks are
+// identified by a pair of numbers; fixing the first one keeps our locks from clashing with
+// any other advisory locks in the same database.
+const jobLockClass = 0x1d0
+
+// jobLocks holds the connections of the job locks this instance has. An advisory lock taken
+// with pg_try_advisory_lock belongs to the session that took it, so each lock needs its own
+// connection that isn't returned to the pool while the lock is held. If the instance dies, its
+// connections close and PostgreSQL releases the locks, so another instance takes over the job
+// the next time it tries.
+type jobLocks struct {
+	mu    sync.Mutex
+	conns map[string]*sql.Conn
+}
+
+// JobLeader is the instance holding a job's lock.
+type JobLeader struct {
+	Job string `json:"job" db:"job"`
+	// Holder is the application name of the holding connection, which identifies the
+	// instance by host name and process id.
+	Holder string `json:"holder" db:"holder"`
+	// ClientAddr is the holder's address as seen by PostgreSQL.
+	ClientAddr *string `json:"client_addr" db:"client_addr"`
+	// Since is when the holding connection was opened, which is about when it took the lock.
+	Since time.Time `json:"since" db:"since"`
+}
+
+// jobLockKey returns the second half of the key of the named job's lock.
+func jobLockKey(job string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(job))
+	return h.Sum32()
+}
+
+func (m *pgManager) TryJobLock(job string) (bool, error) {
+	m.locks.mu.Lock()
+	defer m.locks.mu.Unlock()
+
+	ctx := context.Background()
+	// If we already hold the lock, we check that its connection is still alive. That is our
+	// lease: if the connection dropped, the lock is gone and another instance may have taken
+	// it, so we have to try again like everyone else.
+	if conn, ok := m.locks.conns[job]; ok {
+		if err := conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		conn.Close()
+		delete(m.locks.conns, job)
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	// The application name shows up in pg_stat_activity, which is how GetJobLeaders tells
+	// which instance holds each lock.
+	host, _ := os.Hostname()
+	if _, err := conn.ExecContext(ctx, "SELECT set_config('application_name', $1, false)",
+		fmt.Sprintf("ls-todo %s:%d", host, os.Getpid())); err != nil {
+		conn.Close()
+		return false, mapError(err)
+	}
+	// The key is a signed int4 in SQL, so we reinterpret the hash's bits as one.
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)",
+		jobLockClass, int32(jobLockKey(job))).Scan(&locked); err != nil {
+		conn.Close()
+		return false, mapError(err)
+	}
+	if !locked {
+		conn.Close()
+		return false, nil
+	}
+	m.locks.conns[job] = conn
+	return true, nil
+}
+
+func (m *pgManager) GetJobLeaders(jobs []string) ([]JobLeader, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// pg_locks shows the halves of the key as oids, which are unsigned, so we compare the
+	// second with the hash as is rather than as the int4 we locked with. An objsubid of 2
+	// marks locks taken with a pair of keys.
+	leaders := []JobLeader{}
+	for _, job := range jobs {
+		var leader JobLeader
+		err := tx.QueryRowx(`
+			SELECT $3 AS job, a.application_name AS holder, a.client_addr::text AS client_addr,
+			       a.backend_start AS since
+			  FROM pg_locks l
+			  JOIN pg_stat_activity a ON a.pid = l.pid
+			 WHERE l.locktype = 'advisory' AND l.granted AND l.database = (
+				   SELECT oid FROM pg_database WHERE datname = current_database())
+			   AND l.classid::bigint = $1 AND l.objid::bigint = $2 AND l.objsubid = 2`,
+			jobLockClass, int64(jobLockKey(job)), job).StructScan(&leader)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, mapError(err)
+		}
+		leaders = append(leaders, leader)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return leaders, nil
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"ls-todo/internal/models"
+)
+
+func (m *pgManager) ClearTodoFlag(id int64) (*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	todo := &models.Todo{}
+	if err := tx.QueryRowx(
+		"UPDATE todos SET flag_reason = NULL WHERE id = $1 RETURNING *", id,
+	).StructScan(todo); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return todo, nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"ls-todo/internal/models"
+)
+
+func (m *pgManager) GetPomodoros(todoID int64) ([]*models.Pomodoro, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if exists, err := todoExists(tx, todoID); err != nil || !exists {
+		return nil, err
+	}
+	pomodoros := []*models.Pomodoro{}
+	if err := tx.Select(&pomodoros,
+		"SELECT * FROM todo_pomodoros WHERE todo_id = $1 ORDER BY id", todoID); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return pomodoros, nil
+}
+
+func (m *pgManager) StartPomodoro(todoID int64) (*models.Pomodoro, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// As with shares, selecting the todo's id means a missing todo inserts nothing. A
+	// pomodoro already running on the todo violates todo_pomodoros_running, which mapError
+	// turns into ErrConflict.
+	pomodoro := &models.Pomodoro{}
+	if err := tx.QueryRowx(`
+		INSERT INTO todo_pomodoros (todo_id, started_at)
+		SELECT id, $2 FROM todos WHERE id = $1
+		RETURNING *`, todoID, m.clock.Now()).StructScan(pomodoro); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return pomodoro, nil
+}
+
+func (m *pgManager) CompletePomodoro(todoID, pomodoroID int64) (*models.Pomodoro, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Completing a pomodoro twice keeps the time it was first completed, so a retried request
+	// doesn't add focus time.
+	pomodoro := &models.Pomodoro{}
+	if err := tx.QueryRowx(`
+		UPDATE todo_pomodoros SET completed_at = coalesce(completed_at, $3::timestamptz)
+		 WHERE id = $2 AND todo_id = $1
+		RETURNING *`, todoID, pomodoroID, m.clock.Now()).StructScan(pomodoro); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return pomodoro, nil
+}
+
+func (m *pgManager) GetFocusDays(days int, loc *time.Location) ([]*models.FocusDay, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// `generate_series` gives us a row for every day, so days without any pomodoros are
+	// included with zeros instead of being left out. The days are local times without a time
+	// zone; `AT TIME ZONE` turns each one's midnight back into an absolute time to compare
+	// with, so days start at local midnight.
+	focusDays := []*models.FocusDay{}
+	if err := tx.Select(&focusDays, `
+		SELECT to_char(day, 'YYYY-MM-DD') AS date,
+		       count(p.id) AS pomodoros,
+		       coalesce(sum(extract(epoch FROM p.completed_at - p.started_at)), 0)::bigint AS focus_seconds
+		  FROM generate_series((($1::timestamptz AT TIME ZONE $2)::date - ($3::int - 1))::timestamp,
+		                       ($1::timestamptz AT TIME ZONE $2)::date::timestamp, interval '1 day') AS day
+		  LEFT JOIN todo_pomodoros p
+		    ON p.completed_at >= day AT TIME ZONE $2
+		   AND p.completed_at < (day + interval '1 day') AT TIME ZONE $2
+	  GROUP BY day
+	  ORDER BY day`, m.clock.Now(), loc.String(), days); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return focusDays, nil
+}
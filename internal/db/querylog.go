@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// slowQueries counts the queries that took longer than the slow query threshold since the
+// server started.
+var slowQueries atomic.Int64
+
+// SlowQueries returns how many queries have been slower than the slow query threshold.
+func SlowQueries() int64 {
+	return slowQueries.Load()
+}
+
+// The methods below shadow the ones txn gets from the embedded *sqlx.Tx, so that every query a
+// PGManager method runs is timed and logged without each method having to do it.
+
+func (t *txn) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	defer t.logQuery(query, args, time.Now())
+	return t.Tx.QueryRowx(query, args...)
+}
+
+func (t *txn) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	defer t.logQuery(query, args, time.Now())
+	return t.Tx.Queryx(query, args...)
+}
+
+func (t *txn) Select(dest interface{}, query string, args ...interface{}) error {
+	defer t.logQuery(query, args, time.Now())
+	return t.Tx.Select(dest, query, args...)
+}
+
+func (t *txn) Get(dest interface{}, query string, args ...interface{}) error {
+	defer t.logQuery(query, args, time.Now())
+	return t.Tx.Get(dest, query, args...)
+}
+
+func (t *txn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer t.logQuery(query, args, time.Now())
+	return t.Tx.Exec(query, args...)
+}
+
+// logQuery logs a query that started at the given time. Every query is logged at debug level,
+// and the ones slower than the threshold are also logged as a warning and counted.
+//
+// The arguments are replaced by their types, since their values can be anything a user typed
+// into a todo and don't belong in the logs.
+func (t *txn) logQuery(query string, args []interface{}, started time.Time) {
+	duration := time.Since(started)
+	slow := t.slowQueryThreshold > 0 && duration >= t.slowQueryThreshold
+	if !slow && !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	types := make([]string, len(args))
+	for i, arg := range args {
+		types[i] = fmt.Sprintf("%T", arg)
+	}
+	// Queries are indented to be readable in the code, which makes them hard to read in a
+	// log, so we collapse the whitespace.
+	attrs := []interface{}{"query", strings.Join(strings.Fields(query), " "), "args", types, "duration", duration}
+
+	if slow {
+		slowQueries.Add(1)
+		slog.Warn("slow query", attrs...)
+		return
+	}
+	slog.Debug("query", attrs...)
+}
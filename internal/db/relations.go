@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"ls-todo/internal/models"
+)
+
+func (m *pgManager) GetRelations(todoID int64) ([]*models.Relation, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if exists, err := todoExists(tx, todoID); err != nil || !exists {
+		return nil, err
+	}
+	relations, err := getRelations(tx, todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return relations, nil
+}
+
+func (m *pgManager) CreateRelation(todoID int64, relation *models.Relation) (*models.Relation, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The foreign key can't tell a missing todo apart from a missing target, so the todo
+	// is checked first.
+	if exists, err := todoExists(tx, todoID); err != nil || !exists {
+		return nil, err
+	}
+	// The table's constraints do the rest of the validation for us: an unknown kind or a link
+	// to itself fails a CHECK, a missing target fails a foreign key, and an existing link
+	// fails a unique constraint. mapError turns these into ErrInvalid and ErrConflict.
+	created := &models.Relation{}
+	if err := tx.QueryRowx(`
+		INSERT INTO todo_relations (from_todo_id, to_todo_id, kind) VALUES ($1, $2, $3)
+		RETURNING id, kind, to_todo_id AS todo_id`,
+		todoID, relation.TodoID, relation.Kind).StructScan(created); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return created, nil
+}
+
+func (m *pgManager) DeleteRelation(todoID, relationID int64) (*models.Relation, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// A relation belongs to both of the todos it links, so it can be deleted from either.
+	deleted := &models.Relation{}
+	if err := tx.QueryRowx(`
+		DELETE FROM todo_relations
+		 WHERE id = $2 AND (from_todo_id = $1 OR to_todo_id = $1)
+	 RETURNING id, kind, CASE WHEN from_todo_id = $1 THEN to_todo_id ELSE from_todo_id END AS todo_id`,
+		todoID, relationID).StructScan(deleted); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return deleted, nil
+}
+
+// todoRow is a todo as read by a list query, which may have its relations alongside it as a
+// JSON array (see withRelations).
+type todoRow struct {
+	models.Todo
+	RelationsJSON []byte `db:"relations"`
+}
+
+// withRelations wraps a list query so that it also returns each todo's relations, as a JSON
+// array in a `relations` column, and returns it with the extra arguments it needs. order is
+// the query's ORDER BY, which has to be repeated since a join doesn't keep the order.
+//
+// Loading the relations of each todo separately would take a query per todo. Instead the page
+// is fetched first and the relations of just those todos are aggregated onto it, so a page
+// with relations is still a single round trip. The relations are looked up from both ends, in
+// the same way as getRelations.
+func withRelations(query, order string, args []interface{}) (string, []interface{}) {
+	n := len(args)
+	return fmt.Sprintf(`
+		WITH page AS (%s)
+		SELECT page.*, r.relations
+		  FROM page
+		 CROSS JOIN LATERAL (
+			   SELECT coalesce(json_agg(rel ORDER BY rel.id), '[]') AS relations
+				 FROM (
+					   SELECT id, kind, to_todo_id AS todo_id
+						 FROM todo_relations
+						WHERE from_todo_id = page.id
+					UNION ALL
+					   SELECT id, CASE kind WHEN $%d THEN $%d ELSE kind END, from_todo_id
+						 FROM todo_relations
+						WHERE to_todo_id = page.id
+					  ) rel
+			   ) r
+	  ORDER BY %s`, query, n+1, n+2, order),
+		append(args, models.RelationDuplicateOf, models.RelationDuplicatedBy)
+}
+
+// getRelations retrieves the relations of a todo inside the given transaction. Relations are
+// stored in one direction, so we look them up from both ends and flip the ones that point at
+// this todo.
+func getRelations(tx *txn, todoID int64) ([]*models.Relation, error) {
+	relations := []*models.Relation{}
+	if err := tx.Select(&relations, `
+		SELECT id, kind, to_todo_id AS todo_id
+		  FROM todo_relations
+		 WHERE from_todo_id = $1
+	 UNION ALL
+		SELECT id,
+		       CASE kind WHEN $2 THEN $3 ELSE kind END,
+		       from_todo_id
+		  FROM todo_relations
+		 WHERE to_todo_id = $1
+	  ORDER BY id`,
+		todoID, models.RelationDuplicateOf, models.RelationDuplicatedBy); err != nil {
+		return nil, mapError(err)
+	}
+	return relations, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"ls-todo/internal/clock"
+	"ls-todo/internal/models"
+)
+
+// createLinkedTodos creates n todos, each related to the next, so that every todo but the
+// first and last has two relations.
+func createLinkedTodos(tb testing.TB, m *pgManager, n int) {
+	tb.Helper()
+	for i := 1; i <= n; i++ {
+		if _, err := m.CreateTodo(&models.Todo{Title: "todo"}); err != nil {
+			tb.Fatalf("CreateTodo: %v", err)
+		}
+		if i == 1 {
+			continue
+		}
+		relation := &models.Relation{Kind: models.RelationRelated, TodoID: int64(i)}
+		if _, err := m.CreateRelation(int64(i-1), relation); err != nil {
+			tb.Fatalf("CreateRelation: %v", err)
+		}
+	}
+}
+
+// TestExpandRelations checks that the relations loaded with a list are the same as the ones
+// GetRelations returns for each todo on its own, for both lists that support them.
+func TestExpandRelations(t *testing.T) {
+	m := testManager(t, clock.NewFake())
+	createLinkedTodos(t, m, 5)
+	for _, id := range []int64{2, 3} {
+		if _, err := m.ToggleStarred(id); err != nil {
+			t.Fatalf("ToggleStarred: %v", err)
+		}
+	}
+
+	lists := map[string]func(ListOptions) ([]*models.Todo, error){
+		"GetTodos":        m.GetTodos,
+		"GetStarredTodos": m.GetStarredTodos,
+	}
+	for name, list := range lists {
+		todos, err := list(ListOptions{Relations: true})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(todos) == 0 {
+			t.Fatalf("%s returned no todos", name)
+		}
+		for _, todo := range todos {
+			want, err := m.GetRelations(todo.ID)
+			if err != nil {
+				t.Fatalf("GetRelations(%d): %v", todo.ID, err)
+			}
+			if !reflect.DeepEqual(todo.Relations, want) {
+				t.Errorf("%s: todo %d: relations %+v, want %+v", name, todo.ID, todo.Relations, want)
+			}
+		}
+	}
+}
+
+// BenchmarkListRelations compares loading a page of todos with their relations in one query
+// (`?expand=relations`) against loading the page and then each todo's relations separately,
+// which is what clients had to do before.
+func BenchmarkListRelations(b *testing.B) {
+	m := testManager(b, clock.NewFake())
+	createLinkedTodos(b, m, 100)
+
+	b.Run("expand", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := m.GetTodos(ListOptions{Relations: true}); err != nil {
+				b.Fatalf("GetTodos: %v", err)
+			}
+		}
+	})
+	b.Run("per_todo", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			todos, err := m.GetTodos(ListOptions{})
+			if err != nil {
+				b.Fatalf("GetTodos: %v", err)
+			}
+			for _, todo := range todos {
+				if todo.Relations, err = m.GetRelations(todo.ID); err != nil {
+					b.Fatalf("GetRelations: %v", err)
+				}
+			}
+		}
+	})
+}
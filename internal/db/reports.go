@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrUnknownReport is returned when asking for a report that doesn't exist.
+var ErrUnknownReport = errors.New("unknown report")
+
+// Reporter runs the read-only reports available to admins. Rather than giving analysts
+// credentials to the database, we expose a small set of named queries whose only inputs are
+// bound parameters, so there is no way to run arbitrary SQL through it.
+type Reporter interface {
+	// Reports returns the names of the available reports.
+	Reports() []string
+	// RunReport runs the named report with the given parameters and returns at most limit rows.
+	RunReport(name string, params map[string]string, limit int) ([]map[string]interface{}, error)
+}
+
+// report is a named, parameterized query.
+type report struct {
+	// query is the SQL for the report. It may reference the report's parameters as $1, $2, etc.
+	query string
+	// params are the names of the parameters the report needs, in the order they are bound.
+	params []string
+}
+
+// reports are all of the reports a Reporter can run.
+var reports = map[string]report{
+	"todos_by_status": {
+		query: `
+			SELECT completed, count(*) AS todos
+			  FROM todos
+		  GROUP BY completed
+		  ORDER BY completed`,
+	},
+	"todos_by_due_year": {
+		query: `
+			SELECT year, count(*) AS todos, count(*) FILTER (WHERE completed) AS completed
+			  FROM todos
+		  GROUP BY year
+		  ORDER BY year`,
+	},
+	"todos_by_due_month": {
+		query: `
+			SELECT month, count(*) AS todos, count(*) FILTER (WHERE completed) AS completed
+			  FROM todos
+			 WHERE year = $1
+		  GROUP BY month
+		  ORDER BY month`,
+		params: []string{"year"},
+	},
+	"flagged_todos": {
+		query: `
+			SELECT id, title, flag_reason
+			  FROM todos
+			 WHERE flag_reason IS NOT NULL
+		  ORDER BY id`,
+	},
+	"description_lengths": {
+		query: `
+			SELECT count(*) AS todos,
+			       round(avg(length(description))) AS average,
+			       percentile_disc(0.5) WITHIN GROUP (ORDER BY length(description)) AS median,
+			       percentile_disc(0.95) WITHIN GROUP (ORDER BY length(description)) AS p95,
+			       max(length(description)) AS longest
+			  FROM todos`,
+	},
+}
+
+// reporter implements Reporter for "production".
+type reporter struct {
+	// db is the connection reports are run against. This should be a read replica when one
+	// is available so that reports can't slow down the primary.
+	db *sqlx.DB
+}
+
+// NewReporter returns a new Reporter instance that runs reports against the given database.
+func NewReporter(db *sqlx.DB) Reporter {
+	return &reporter{db}
+}
+
+func (r *reporter) Reports() []string {
+	names := make([]string, 0, len(reports))
+	for name := range reports {
+		names = append(names, name)
+	}
+	// Map iteration order is random in Go, so we sort the names to keep the output stable.
+	sort.Strings(names)
+	return names
+}
+
+func (r *reporter) RunReport(name string, params map[string]string, limit int) ([]map[string]interface{}, error) {
+	rep, ok := reports[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownReport, name)
+	}
+	args := make([]interface{}, 0, len(rep.params)+1)
+	for _, param := range rep.params {
+		value, ok := params[param]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing parameter %q", ErrInvalid, param)
+		}
+		args = append(args, value)
+	}
+	args = append(args, limit)
+
+	// Even if we are connected to the primary, a read-only transaction guarantees a report
+	// can never modify anything.
+	tx, err := r.db.BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// We wrap the report in a subquery so that we can apply the row limit to every report
+	// without having to remember to add it to each one.
+	rows, err := tx.Queryx(
+		fmt.Sprintf("SELECT * FROM (%s) AS report LIMIT $%d", rep.query, len(args)), args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	// Since each report returns different columns, we can't scan them into a struct. Instead
+	// we use `MapScan` which gives us a map of column name to value for each row.
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil {
+			return nil, err
+		}
+		// The driver returns text columns as byte slices, which the JSON encoder would turn
+		// into base64. We convert them to strings so they come out readable.
+		for column, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return results, nil
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"ls-todo/internal/models"
+)
+
+func (m *pgManager) RescheduleTodos(ids []int64, days int) ([]*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The due date is stored as three text columns, which PostgreSQL can't do date arithmetic
+	// on reliably (older todos can have dates that don't exist), so we lock the todos, shift
+	// their dates here and write them back.
+	todos := []*models.Todo{}
+	if err := tx.Select(&todos, "SELECT * FROM todos WHERE id = ANY($1) ORDER BY id FOR UPDATE",
+		pq.Array(ids)); err != nil {
+		return nil, mapError(err)
+	}
+
+	rescheduled := []*models.Todo{}
+	for _, todo := range todos {
+		// Only the date matters, so the time zone doesn't.
+		due, ok := todo.Due(time.UTC)
+		if !ok {
+			continue
+		}
+		due = due.AddDate(0, 0, days)
+		updated := &models.Todo{}
+		if err := tx.QueryRowx("UPDATE todos SET day = $2, month = $3, year = $4 WHERE id = $1 RETURNING *",
+			todo.ID, fmt.Sprintf("%02d", due.Day()), fmt.Sprintf("%02d", due.Month()),
+			fmt.Sprintf("%04d", due.Year())).StructScan(updated); err != nil {
+			return nil, mapError(err)
+		}
+		rescheduled = append(rescheduled, updated)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return rescheduled, nil
+}
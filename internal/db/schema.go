@@ -0,0 +1,107 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// expectedIndexes are the indexes the queries in this package rely on. They are created by the
+// migrations; this list has to be kept in step with them.
+var expectedIndexes = []string{
+	"todos_starred_id",
+	"todos_completed_at",
+	"todos_due_id",
+	"todos_created_at_id",
+	"todos_custom_fields",
+	"todos_flagged",
+	"todos_latitude",
+	"todo_relations_related_unique",
+	"todo_relations_to_todo_id",
+	"todo_events_todo_id_created_at",
+	"todo_events_archive_todo_id_created_at",
+	"todo_events_archive_created_at",
+	"todo_shares_todo_id",
+	"todo_pomodoros_todo_id",
+	"todo_pomodoros_running",
+	"todo_pomodoros_completed_at",
+}
+
+// MissingIndexes returns the expected indexes that don't exist in the database. A missing
+// index doesn't break anything straight away, but queries that should be fast will scan whole
+// tables, which only shows up once the tables are big. Checking at startup catches a skipped
+// migration before that happens.
+func MissingIndexes(db *sqlx.DB) ([]string, error) {
+	var existing []string
+	if err := db.Select(&existing, `
+		SELECT indexname FROM pg_indexes
+		 WHERE schemaname = current_schema() AND indexname = ANY($1)`,
+		pq.Array(expectedIndexes)); err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	for _, name := range existing {
+		found[name] = true
+	}
+	missing := []string{}
+	for _, name := range expectedIndexes {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// RequiredSchemaVersion is the version of the newest migration this code depends on. It has
+// to be bumped whenever a migration adds something the code uses. Newer schemas are accepted,
+// since migrations only ever add to the schema until the code that used the old parts is
+// gone, which is what lets old and new servers run side by side during a deploy.
+const RequiredSchemaVersion = 20261015230000
+
+// SchemaVersion describes the migrations that have been applied to the database.
+type SchemaVersion struct {
+	// Version is the version of the last migration applied, or zero if none have been.
+	Version int64 `json:"version" db:"version"`
+	// Dirty is true if the last migration failed partway through and needs fixing by hand.
+	Dirty bool `json:"dirty" db:"dirty"`
+	// Required is RequiredSchemaVersion, included so the two can be compared at a glance.
+	Required int64 `json:"required" db:"-"`
+}
+
+// Compatible returns whether this code can safely write to the database.
+func (v *SchemaVersion) Compatible() bool {
+	return !v.Dirty && v.Version >= v.Required
+}
+
+func (m *pgManager) GetSchemaVersion() (*SchemaVersion, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The migrate tool keeps the current version in a table with a single row. It only
+	// exists once migrate has run, so a missing table counts as no migrations at all. We have
+	// to check for it separately: a query naming a missing table fails, whatever its WHERE.
+	version := &SchemaVersion{Required: RequiredSchemaVersion}
+	var migrated bool
+	if err := tx.QueryRowx(
+		"SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&migrated); err != nil {
+		return nil, mapError(err)
+	}
+	if migrated {
+		if err := tx.QueryRowx(
+			"SELECT version, dirty FROM schema_migrations LIMIT 1").StructScan(version); err != nil &&
+			!errors.Is(err, sql.ErrNoRows) {
+			return nil, mapError(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return version, nil
+}
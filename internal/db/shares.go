@@ -0,0 +1,129 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"ls-todo/internal/models"
+)
+
+// shareTokenBytes is how many random bytes make up a share token. 32 bytes (256 bits) can't
+// be guessed.
+const shareTokenBytes = 32
+
+func (m *pgManager) GetShares(todoID int64) ([]*models.Share, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if exists, err := todoExists(tx, todoID); err != nil || !exists {
+		return nil, err
+	}
+	shares := []*models.Share{}
+	if err := tx.Select(&shares, "SELECT * FROM todo_shares WHERE todo_id = $1 ORDER BY id", todoID); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return shares, nil
+}
+
+func (m *pgManager) CreateShare(todoID int64, expiresAt time.Time) (*models.Share, error) {
+	// The token is random rather than derived from the todo, so that knowing one share (or
+	// the todo's id) tells you nothing about any other.
+	b := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Selecting the todo's id rather than inserting it directly means that a missing todo
+	// inserts nothing, so we can tell it apart from other errors.
+	share := &models.Share{}
+	if err := tx.QueryRowx(`
+		INSERT INTO todo_shares (todo_id, token, expires_at)
+		SELECT id, $2, $3 FROM todos WHERE id = $1
+		RETURNING *`, todoID, token, expiresAt).StructScan(share); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return share, nil
+}
+
+func (m *pgManager) RevokeShare(todoID, shareID int64) (*models.Share, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Revoked shares are kept rather than deleted so their view counts aren't lost.
+	// Revoking one twice keeps the time it was first revoked.
+	share := &models.Share{}
+	if err := tx.QueryRowx(`
+		UPDATE todo_shares SET revoked_at = coalesce(revoked_at, $3::timestamptz)
+		 WHERE id = $2 AND todo_id = $1
+		RETURNING *`, todoID, shareID, m.clock.Now()).StructScan(share); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return share, nil
+}
+
+func (m *pgManager) ViewShare(token string) (*models.Todo, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Counting the view and checking the share is still valid happen in the same statement,
+	// so an expired or revoked share is never counted. A todo flagged by the content filter
+	// can't be viewed until an admin has reviewed it, so its shares act as if they'd expired.
+	var todoID int64
+	if err := tx.QueryRowx(`
+		UPDATE todo_shares SET views = views + 1
+		 WHERE token = $1 AND revoked_at IS NULL AND expires_at > $2
+		   AND NOT EXISTS (SELECT 1 FROM todos WHERE id = todo_id AND flag_reason IS NOT NULL)
+		RETURNING todo_id`, token, m.clock.Now()).Scan(&todoID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	var todo models.Todo
+	if err := tx.QueryRowx("SELECT * FROM todos WHERE id = $1", todoID).StructScan(&todo); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return &todo, nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SortKey is one of the keys a list is ordered by.
+type SortKey struct {
+	// Field is the name of the field to sort by. It must be one of sortFields.
+	Field string
+	// Desc sorts in descending order rather than ascending.
+	Desc bool
+}
+
+// sortFields maps the fields clients can sort lists by to the columns they sort on. Only these
+// names ever make it into a query, which is what makes building ORDER BY from client input
+// safe.
+var sortFields = map[string][]string{
+	"id":           {"id"},
+	"title":        {"title"},
+	"starred":      {"starred"},
+	"completed":    {"completed"},
+	"completed_at": {"completed_at"},
+	"created_at":   {"created_at"},
+	// The due date parts are zero-padded (by Normalize when saved, and by a migration for
+	// older todos), so sorting them as text gives date order.
+	"due_date": {"year", "month", "day"},
+}
+
+// IsSortField returns whether lists can be sorted by the given field.
+func IsSortField(field string) bool {
+	_, ok := sortFields[field]
+	return ok
+}
+
+// ParseSort parses a sort written like the `sort` query parameter: a comma separated list of
+// fields, each prefixed with `-` to sort it in descending order (e.g. `-starred,due_date`). An
+// empty string is no sort at all.
+func ParseSort(sort string) ([]SortKey, error) {
+	if sort == "" {
+		return nil, nil
+	}
+	var keys []SortKey
+	for _, field := range strings.Split(sort, ",") {
+		key := SortKey{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		if !IsSortField(key.Field) {
+			return nil, fmt.Errorf("can't sort by %q", key.Field)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// listOrder returns the ORDER BY clause (without the keywords) of a list in the given order. A
+// list sorted by a keyset field can be paged with a cursor, so its first page has to be in the
+// same order as the pages the cursor seeks to (see keysetOrder). Any other order is built by
+// orderBy.
+func listOrder(keys []SortKey, fallback string) string {
+	if IsKeysetSort(keys) {
+		return keysetOrder(keys[0])
+	}
+	return orderBy(keys, fallback)
+}
+
+// orderBy builds an ORDER BY clause (without the keywords) for the given keys, or returns
+// fallback if there aren't any. Unknown fields are skipped, so callers should check them with
+// IsSortField first.
+//
+// Rows that are equal on every key would otherwise come back in whatever order PostgreSQL
+// finds them, which can change between queries and make rows jump between pages. So unless the
+// keys already include it, we always sort by id last to break ties.
+func orderBy(keys []SortKey, fallback string) string {
+	if len(keys) == 0 {
+		return fallback
+	}
+	var terms []string
+	hasID := false
+	for _, key := range keys {
+		columns, ok := sortFields[key.Field]
+		if !ok {
+			continue
+		}
+		hasID = hasID || key.Field == "id"
+		for _, column := range columns {
+			if key.Desc {
+				// NULLS LAST keeps todos without a value at the end either way, rather
+				// than moving them to the start when the order is reversed.
+				terms = append(terms, column+" DESC NULLS LAST")
+			} else {
+				terms = append(terms, column)
+			}
+		}
+	}
+	if !hasID {
+		terms = append(terms, "id")
+	}
+	return strings.Join(terms, ", ")
+}
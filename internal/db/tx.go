@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// txn is the transaction a PGManager method runs in. Usually it is a new transaction owned by
+// the method, but inside WithTx every method shares the one WithTx opened. In that case the
+// transaction is "nested": committing or rolling it back is left to WithTx, so the methods'
+// own Commit and Rollback calls do nothing.
+type txn struct {
+	*sqlx.Tx
+	nested bool
+	// slowQueryThreshold is how long a query can take before it is logged as slow.
+	slowQueryThreshold time.Duration
+}
+
+func (t *txn) Commit() error {
+	if t.nested {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t *txn) Rollback() error {
+	if t.nested {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// begin returns the transaction a method should run in: the one opened by WithTx if there is
+// one, or a new one otherwise.
+func (m *pgManager) begin() (*txn, error) {
+	// Injected faults look like serialization failures, which is the error clients are
+	// expected to retry.
+	if m.faultRate > 0 && rand.Float64() < m.faultRate {
+		return nil, fmt.Errorf("%w: injected fault", ErrRetryable)
+	}
+	if m.tx != nil {
+		return &txn{Tx: m.tx, nested: true, slowQueryThreshold: m.slowQueryThreshold}, nil
+	}
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx, slowQueryThreshold: m.slowQueryThreshold}, nil
+}
+
+func (m *pgManager) WithTx(ctx context.Context, fn func(tx PGManager) error) error {
+	// Calling WithTx inside WithTx just joins the transaction that is already open.
+	if m.tx != nil {
+		return fn(m)
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The PGManager passed to fn is a copy of this one that runs every method in tx.
+	scoped := *m
+	scoped.tx = tx
+	if err := fn(&scoped); err != nil {
+		return err
+	}
+	return mapError(tx.Commit())
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"ls-todo/internal/models"
+)
+
+func (m *pgManager) GetListViews(clientID string) ([]*models.ListView, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	views := []*models.ListView{}
+	if err := tx.Select(&views, "SELECT * FROM list_views WHERE client_id = $1 ORDER BY name",
+		clientID); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return views, nil
+}
+
+func (m *pgManager) GetListView(clientID, name string) (*models.ListView, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	view := &models.ListView{}
+	if err := tx.QueryRowx("SELECT * FROM list_views WHERE client_id = $1 AND name = $2",
+		clientID, name).StructScan(view); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return view, nil
+}
+
+func (m *pgManager) PutListView(view *models.ListView) (*models.ListView, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	filters := view.Filters
+	if filters == nil {
+		filters = models.JSONObject{}
+	}
+	// The name and layout are checked by the table, the same way custom field names are.
+	saved := &models.ListView{}
+	if err := tx.QueryRowx(`
+		INSERT INTO list_views (client_id, name, sort, filters, page_size, layout, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (client_id, name) DO UPDATE
+		SET sort = EXCLUDED.sort, filters = EXCLUDED.filters, page_size = EXCLUDED.page_size,
+		    layout = EXCLUDED.layout, updated_at = EXCLUDED.updated_at
+		RETURNING *`,
+		view.ClientID, view.Name, view.Sort, filters, view.PageSize, view.Layout,
+		m.clock.Now()).StructScan(saved); err != nil {
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return saved, nil
+}
+
+func (m *pgManager) DeleteListView(clientID, name string) (*models.ListView, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := &models.ListView{}
+	if err := tx.QueryRowx("DELETE FROM list_views WHERE client_id = $1 AND name = $2 RETURNING *",
+		clientID, name).StructScan(deleted); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, mapError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+	return deleted, nil
+}
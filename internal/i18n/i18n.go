@@ -0,0 +1,130 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the language we fall back to when none of the client's languages have a
+// translation. Every message must exist in its catalog.
+const DefaultLanguage = "en"
+
+// The `go:embed` directive below makes the compiler include the catalog files in the binary, so
+// we don't have to ship them separately or know where they are on disk at runtime.
+//
+//go:embed catalogs/*.json
+var catalogFiles embed.FS
+
+// catalogs maps a language (e.g. "es") to its messages, keyed by message code.
+var catalogs = loadCatalogs()
+
+// loadCatalogs parses the embedded catalog files. A broken catalog is a bug in the build, so we
+// panic rather than start without it.
+func loadCatalogs() map[string]map[string]string {
+	entries, err := catalogFiles.ReadDir("catalogs")
+	if err != nil {
+		panic(err)
+	}
+	result := map[string]map[string]string{}
+	for _, entry := range entries {
+		data, err := catalogFiles.ReadFile(path.Join("catalogs", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("invalid catalog %s: %v", entry.Name(), err))
+		}
+		result[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+	return result
+}
+
+// Localizer translates messages into the languages a client prefers.
+type Localizer struct {
+	// languages are the languages to try, most preferred first, ending with DefaultLanguage.
+	languages []string
+}
+
+// New returns a Localizer for the given Accept-Language header value, e.g. "es-MX,es;q=0.9".
+func New(acceptLanguage string) *Localizer {
+	return &Localizer{languages: fallbackChain(acceptLanguage)}
+}
+
+// Language returns the language messages will be translated into (as far as they can be).
+func (l *Localizer) Language() string {
+	for _, lang := range l.languages {
+		if _, ok := catalogs[lang]; ok {
+			return lang
+		}
+	}
+	return DefaultLanguage
+}
+
+// T returns the message for code in the client's most preferred language that has one. Any
+// args are formatted into the message as with fmt.Sprintf. If no catalog has the message, the
+// code itself is returned.
+func (l *Localizer) T(code string, args ...interface{}) string {
+	for _, lang := range l.languages {
+		if message, ok := catalogs[lang][code]; ok {
+			if len(args) == 0 {
+				return message
+			}
+			return fmt.Sprintf(message, args...)
+		}
+	}
+	return code
+}
+
+// fallbackChain turns an Accept-Language header into the list of languages to try. Each
+// regional language is followed by its base language (es-MX is followed by es), and the
+// default language always comes last.
+func fallbackChain(acceptLanguage string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var prefs []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.ToLower(strings.TrimSpace(fields[0]))
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v := strings.TrimSpace(param); strings.HasPrefix(v, "q=") {
+				if parsed, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, weighted{lang, q})
+		}
+	}
+	// A stable sort keeps languages with the same weight in the order the client sent them.
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	seen := map[string]bool{}
+	var chain []string
+	add := func(lang string) {
+		if !seen[lang] {
+			seen[lang] = true
+			chain = append(chain, lang)
+		}
+	}
+	for _, pref := range prefs {
+		add(pref.lang)
+		if base, _, found := strings.Cut(pref.lang, "-"); found {
+			add(base)
+		}
+	}
+	add(DefaultLanguage)
+	return chain
+}
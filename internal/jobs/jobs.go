@@ -0,0 +1,220 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"ls-todo/internal/clock"
+	"ls-todo/internal/config"
+	"ls-todo/internal/db"
+	"ls-todo/internal/reporting"
+)
+
+// Run describes the history of a background job, so operators can check that it is running
+// and whether it is failing.
+type Run struct {
+	Name         string        `json:"name"`
+	Interval     time.Duration `json:"interval"`
+	Registered   time.Time     `json:"registered"`
+	Runs         int           `json:"runs"`
+	Failures     int           `json:"failures"`
+	LastStarted  *time.Time    `json:"last_started"`
+	LastFinished *time.Time    `json:"last_finished"`
+	LastError    string        `json:"last_error,omitempty"`
+	// ConsecutiveFailures is how many of the latest runs failed in a row. It goes back to zero
+	// as soon as a run succeeds.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// Late is true if the job hasn't finished a run in twice its interval, which means it is
+	// stuck or has stopped. It is worked out when the history is read.
+	Late bool `json:"late"`
+}
+
+// late returns whether the job should have finished a run by now but hasn't. We allow twice
+// the interval since a run can take a while, and the next one only starts an interval later.
+func (r *Run) late(now time.Time) bool {
+	last := r.Registered
+	if r.LastFinished != nil {
+		last = *r.LastFinished
+	}
+	return now.Sub(last) > 2*r.Interval
+}
+
+var (
+	// runs holds the history of every job started with Every, keyed by name. Since jobs run in
+	// their own goroutines, access to it must be guarded by runsMu.
+	runs   = map[string]*Run{}
+	runsMu sync.Mutex
+)
+
+// Runs returns the history of every job that has been started, working out whether each is
+// late by the time on clk.
+func Runs(clk clock.Clock) []Run {
+	runsMu.Lock()
+	defer runsMu.Unlock()
+
+	// We return copies so callers can't race with the jobs updating them.
+	now := clk.Now()
+	result := make([]Run, 0, len(runs))
+	for _, run := range runs {
+		copied := *run
+		copied.Late = run.late(now)
+		result = append(result, copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Every calls fn every interval on clk, forever. It is meant to be run in its own goroutine:
+//
+//	go jobs.Every(clk, time.Hour, "my-job", fn)
+//
+// Errors returned by fn are logged and don't stop the job; it will simply try again at the
+// next interval.
+func Every(clk clock.Clock, interval time.Duration, name string, fn func() error) {
+	runsMu.Lock()
+	run := &Run{Name: name, Interval: interval, Registered: clk.Now()}
+	runs[name] = run
+	runsMu.Unlock()
+
+	for {
+		<-clk.After(interval)
+		slog.Debug("running job", "job", name)
+		started := clk.Now()
+		runsMu.Lock()
+		run.LastStarted = &started
+		runsMu.Unlock()
+
+		err := fn()
+
+		finished := clk.Now()
+		runsMu.Lock()
+		run.Runs++
+		run.LastFinished = &finished
+		run.LastError = ""
+		run.ConsecutiveFailures = 0
+		if err != nil {
+			run.Failures++
+			run.ConsecutiveFailures++
+			run.LastError = err.Error()
+		}
+		runsMu.Unlock()
+
+		if err != nil {
+			slog.Error("job failed", "job", name, "error", err)
+		}
+	}
+}
+
+// Singleton wraps a job so that, however many instances of the server are running, only one of
+// them runs it: the first to take the job's lock in the database. The others skip their runs,
+// and take over if the leader stops, the next time they try.
+//
+// Jobs that act on the whole database (purges, archiving) should be wrapped; ones that only
+// look at this instance, like Monitor, shouldn't.
+func Singleton(pgManager db.PGManager, name string, fn func() error) func() error {
+	return func() error {
+		leader, err := pgManager.TryJobLock(name)
+		if err != nil {
+			return err
+		}
+		if !leader {
+			slog.Debug("skipping job, another instance is running it", "job", name)
+			return nil
+		}
+		return fn()
+	}
+}
+
+// Monitor checks the jobs every interval and reports the ones that are late or have failed
+// maxFailures times in a row, so that someone finds out about a broken job without having to
+// watch the admin endpoint. Like Every, it is meant to be run in its own goroutine.
+//
+// Each problem is only reported once, when it starts; a job is reported again if it recovers
+// and then breaks again.
+func Monitor(clk clock.Clock, interval time.Duration, maxFailures int, reporter reporting.Reporter) {
+	reported := map[string]bool{}
+
+	for {
+		<-clk.After(interval)
+		for _, run := range Runs(clk) {
+			var problem error
+			switch {
+			case run.Late:
+				problem = fmt.Errorf("job %s has not finished a run since %s",
+					run.Name, lastFinished(run).Format(time.RFC3339))
+			case maxFailures > 0 && run.ConsecutiveFailures >= maxFailures:
+				problem = fmt.Errorf("job %s failed %d times in a row: %s",
+					run.Name, run.ConsecutiveFailures, run.LastError)
+			}
+
+			if problem == nil {
+				reported[run.Name] = false
+				continue
+			}
+			if !reported[run.Name] {
+				reporter.Report(problem, nil)
+				reported[run.Name] = true
+			}
+		}
+	}
+}
+
+// lastFinished returns when the job last finished a run, or when it was registered if it hasn't
+// finished one yet.
+func lastFinished(run Run) time.Time {
+	if run.LastFinished != nil {
+		return *run.LastFinished
+	}
+	return run.Registered
+}
+
+// PurgeExpiredTodos returns a job that deletes completed todos that are older than the
+// retention period in cfg.
+func PurgeExpiredTodos(cfg *config.Config, pgManager db.PGManager, clk clock.Clock) func() error {
+	return func() error {
+		cutoff, ok := cfg.RetentionCutoff(clk.Now())
+		if !ok {
+			return nil
+		}
+		purged, err := pgManager.PurgeExpiredTodos(cutoff)
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Printf("purged %d todos completed before %s", purged, cutoff.Format(time.RFC3339))
+		}
+		return nil
+	}
+}
+
+// ArchiveTodoEvents returns a job that moves todo events older than cfg.EventArchiveDays to
+// the archive table, then deletes archived events older than cfg.EventRetentionDays. Either
+// step is skipped if it is disabled.
+func ArchiveTodoEvents(cfg *config.Config, pgManager db.PGManager, clk clock.Clock) func() error {
+	return func() error {
+		now := clk.Now()
+		if cutoff, ok := cfg.EventArchiveCutoff(now); ok {
+			archived, err := pgManager.ArchiveTodoEvents(cutoff)
+			if err != nil {
+				return err
+			}
+			if archived > 0 {
+				log.Printf("archived %d todo events from before %s", archived, cutoff.Format(time.RFC3339))
+			}
+		}
+		if cutoff, ok := cfg.EventRetentionCutoff(now); ok {
+			purged, err := pgManager.PurgeArchivedTodoEvents(cutoff)
+			if err != nil {
+				return err
+			}
+			if purged > 0 {
+				log.Printf("purged %d archived todo events from before %s", purged, cutoff.Format(time.RFC3339))
+			}
+		}
+		return nil
+	}
+}
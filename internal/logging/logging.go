@@ -0,0 +1,16 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Level is the minimum level that is logged. It is a `LevelVar` rather than a plain `Level`
+// so that it can be changed while the app is running (see the admin loglevel endpoint), and
+// every logger created by New will pick up the change immediately.
+var Level = new(slog.LevelVar)
+
+// New returns a logger that writes to w, dropping anything below Level.
+func New(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: Level}))
+}
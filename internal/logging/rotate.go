@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp appended to the names of rotated files. It sorts in the
+// same order as the times it represents, which pruning relies on.
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingFile is an io.Writer that appends to a file, moving it aside and starting a new one
+// once it gets too big or too old. Only the most recent rotated files are kept, so logging to
+// it can't fill up the disk.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	// Writes can come from many goroutines at once, so everything below is guarded by mu.
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// NewRotatingFile opens (or creates) the file at path. It is rotated before a write would take
+// it over maxSize bytes, or once it has been open for maxAge; zero disables either check. At
+// most maxBackups rotated files are kept.
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write writes p to the file, rotating it first if needed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tooBig := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	tooOld := f.maxAge > 0 && time.Since(f.opened) >= f.maxAge
+	if tooBig || tooOld {
+		// If rotating fails but the file is still open, we keep writing to it rather than
+		// lose the line. The next write tries to rotate again.
+		if err := f.rotate(); err != nil && f.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// open opens the file for appending and records its current size.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// rotate moves the current file aside, opens a new one and deletes old backups. If the file
+// can't be moved, the original is opened again so that writes can carry on. f.file is nil
+// afterwards only if no file could be opened at all.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+	backup := fmt.Sprintf("%s.%s", f.path, time.Now().UTC().Format(backupTimeFormat))
+	if err := os.Rename(f.path, backup); err != nil {
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.prune()
+}
+
+// prune deletes all but the newest maxBackups rotated files.
+func (f *RotatingFile) prune() error {
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	if len(backups) <= f.maxBackups {
+		return nil
+	}
+	// The timestamps in the names sort chronologically, so the oldest files come first.
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-f.maxBackups] {
+		if err := os.Remove(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backups returns the paths of the rotated files. Only names rotate could have produced count,
+// so other files next to the log that happen to start with its name (say app.log.lock) are
+// never deleted.
+func (f *RotatingFile) backups() ([]string, error) {
+	dir, base := filepath.Dir(f.path), filepath.Base(f.path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := base + "."
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, name[len(prefix):]); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+	return backups, nil
+}
@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeLine writes a line to f, failing the test on error. Backups are named after the time
+// to the millisecond, so it waits a little first to keep every rotation's name unique.
+func writeLine(t *testing.T, f *RotatingFile, line string) {
+	t.Helper()
+	time.Sleep(2 * time.Millisecond)
+	if _, err := f.Write([]byte(line)); err != nil {
+		t.Fatalf("Write(%q): %v", line, err)
+	}
+}
+
+// listDir returns the names of the files in dir, sorted.
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, 11, 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	writeLine(t, f, "12345\n")
+	writeLine(t, f, "6789\n")
+	// This one would take the file over 11 bytes, so it goes in a new file.
+	writeLine(t, f, "abc\n")
+
+	if got := readFile(t, path); got != "abc\n" {
+		t.Errorf("current file = %q, want %q", got, "abc\n")
+	}
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want one", backups)
+	}
+	if got := readFile(t, backups[0]); got != "12345\n6789\n" {
+		t.Errorf("backup = %q, want %q", got, "12345\n6789\n")
+	}
+}
+
+func TestRotatingFileKeepsMaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	// Files next to the log whose names start with its name, but that rotate didn't make,
+	// have to be left alone.
+	others := []string{"app.log.access", "app.log.lock", "app.log.20240101"}
+	for _, name := range others {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("keep"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := NewRotatingFile(path, 4, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Each line fills the file, so every write after the first rotates it.
+	for _, line := range []string{"one\n", "two\n", "thr\n", "fou\n", "fiv\n"} {
+		writeLine(t, f, line)
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want two", backups)
+	}
+	// The newest backups are the ones kept.
+	if got := readFile(t, backups[0]) + readFile(t, backups[1]); got != "thr\nfou\n" {
+		t.Errorf("backups hold %q, want %q", got, "thr\nfou\n")
+	}
+	for _, name := range others {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was deleted: %v", name, err)
+		}
+	}
+	if want := 1 + 2 + len(others); len(listDir(t, dir)) != want {
+		t.Errorf("directory holds %v, want %d files", listDir(t, dir), want)
+	}
+}
+
+func TestRotatingFileKeepsWritingWhenRenameFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, 4, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	writeLine(t, f, "one\n")
+
+	// With the file gone (say something else moved it away), renaming it fails.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	writeLine(t, f, "two\n")
+	if got := readFile(t, path); got != "two\n" {
+		t.Errorf("after a failed rotation the file holds %q, want %q", got, "two\n")
+	}
+
+	// Later rotations work as normal.
+	writeLine(t, f, "thr\n")
+	if got := readFile(t, path); got != "thr\n" {
+		t.Errorf("after rotating again the file holds %q, want %q", got, "thr\n")
+	}
+	if backups, err := f.backups(); err != nil || len(backups) != 1 {
+		t.Errorf("backups = %v (%v), want one", backups, err)
+	}
+}
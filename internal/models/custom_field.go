@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The types a custom field can have.
+const (
+	CustomFieldText   = "text"
+	CustomFieldNumber = "number"
+	CustomFieldDate   = "date"
+	CustomFieldSelect = "select"
+)
+
+// CustomFieldDefinition describes a custom field that todos can have. Different teams need to
+// track different things on their todos, so rather than adding a column for each, admins
+// define the fields they need and the values are stored in the todo's `custom_fields`.
+type CustomFieldDefinition struct {
+	Name string `json:"name" db:"name"`
+	Type string `json:"type" db:"type"`
+	// Options are the allowed values of a select field. `pq.StringArray` lets us read and
+	// write a PostgreSQL TEXT[] column.
+	Options pq.StringArray `json:"options" db:"options"`
+}
+
+// Validate checks that value is acceptable for the field. A nil value is always acceptable,
+// since it is used to clear the field.
+func (d *CustomFieldDefinition) Validate(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	// Values come from decoded JSON, so numbers are float64 and everything else we accept is
+	// a string.
+	switch d.Type {
+	case CustomFieldNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s must be a number", d.Name)
+		}
+		return nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("%s must be a string", d.Name)
+	}
+	switch d.Type {
+	case CustomFieldDate:
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return fmt.Errorf("%s must be a date formatted as YYYY-MM-DD", d.Name)
+		}
+	case CustomFieldSelect:
+		for _, option := range d.Options {
+			if s == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %v", d.Name, []string(d.Options))
+	}
+	return nil
+}
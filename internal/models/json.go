@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONObject is a JSON object stored in a JSONB column. database/sql doesn't know how to read or
+// write maps, so we implement the `sql.Scanner` and `driver.Valuer` interfaces to convert it to
+// and from JSON ourselves.
+type JSONObject map[string]interface{}
+
+// Scan implements sql.Scanner. It is called when reading the column from the database.
+func (o *JSONObject) Scan(src interface{}) error {
+	if src == nil {
+		*o = nil
+		return nil
+	}
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a JSONObject", src)
+	}
+	return json.Unmarshal(data, o)
+}
+
+// Value implements driver.Valuer. It is called when writing the column to the database.
+func (o JSONObject) Value() (driver.Value, error) {
+	if o == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	// The driver sends byte slices as binary data (bytea), which PostgreSQL won't accept for a
+	// JSONB column, so we send the JSON as a string instead.
+	return string(data), nil
+}
+
+// MergePatch applies a JSON Merge Patch (RFC 7396) to the object and returns the result. The
+// patch is merged in recursively: keys set to null are removed, nested objects are patched in
+// the same way, and any other value replaces what was there.
+func (o JSONObject) MergePatch(patch map[string]interface{}) JSONObject {
+	result := JSONObject{}
+	for key, value := range o {
+		result[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		patchObject, ok := value.(map[string]interface{})
+		if !ok {
+			result[key] = value
+			continue
+		}
+		// If the patch has an object where the target has something else (or nothing), the
+		// RFC says to patch an empty object, which also strips any nulls out of the patch.
+		target, _ := result[key].(map[string]interface{})
+		result[key] = map[string]interface{}(JSONObject(target).MergePatch(patchObject))
+	}
+	return result
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize tidies up a todo sent by a client before it is stored, so that the same todo
+// always ends up stored the same way whichever client (or integration) sent it. It changes the
+// todo in place:
+//
+//   - Leading and trailing whitespace is removed from every text field.
+//   - The title and description are put in Unicode normalization form C, so that text that
+//     looks the same (e.g. "é" as one character, or as "e" and a combining accent) is stored
+//     the same, and matches the same in searches and the content filter.
+//   - Runs of whitespace in the title, including newlines and tabs, become a single space, and
+//     control characters are removed. Descriptions keep their line breaks.
+//   - A complete due date is written with two digit days and months and a four digit year,
+//     which is the form due_date is converted to and the one that sorts correctly as text.
+//     A month outside 1-12 or a day past the end of the month is clamped to the nearest
+//     valid value, so "2024-02-30" becomes "2024-02-29".
+//     A part sent on its own, as updates can, is only padded.
+//
+// A due date that isn't made of numbers is left alone; it is kept as it always has been, it
+// just doesn't count as a due date.
+func (t *Todo) Normalize() {
+	t.Title = normalizeTitle(t.Title)
+	t.Description = strings.TrimSpace(norm.NFC.String(t.Description))
+	t.Day = strings.TrimSpace(t.Day)
+	t.Month = strings.TrimSpace(t.Month)
+	t.Year = strings.TrimSpace(t.Year)
+	t.normalizeDue()
+}
+
+// normalizeTitle trims the title, collapses its whitespace and drops its control characters.
+func normalizeTitle(title string) string {
+	// Newlines and tabs count as control characters too, so we only drop the ones that aren't
+	// whitespace; the rest are collapsed below.
+	title = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, title)
+	title = norm.NFC.String(title)
+	// `strings.Fields` splits on any run of Unicode whitespace and drops the ends, so joining
+	// the fields back together with single spaces does the trimming and collapsing at once.
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// normalizeDue pads the parts of the due date that are numbers, and clamps them when all three
+// are. An update can send just one part, and we can't clamp a day without knowing the month,
+// but padding it on its own keeps it sorting correctly.
+func (t *Todo) normalizeDue() {
+	day, dayErr := strconv.Atoi(t.Day)
+	month, monthErr := strconv.Atoi(t.Month)
+	year, yearErr := strconv.Atoi(t.Year)
+	if dayErr == nil && monthErr == nil && yearErr == nil {
+		year = clamp(year, 1, 9999)
+		month = clamp(month, 1, 12)
+		// Day 0 of the next month is the last day of this one, and `time.Date` handles leap
+		// years for us.
+		lastDay := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		day = clamp(day, 1, lastDay)
+	}
+
+	if dayErr == nil {
+		t.Day = fmt.Sprintf("%02d", day)
+	}
+	if monthErr == nil {
+		t.Month = fmt.Sprintf("%02d", month)
+	}
+	if yearErr == nil {
+		t.Year = fmt.Sprintf("%04d", year)
+	}
+}
+
+// clamp returns n limited to the range [lo, hi].
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		todo, want Todo
+	}{
+		{
+			name: "trims every text field",
+			todo: Todo{Title: "  Buy milk ", Description: "\n Semi-skimmed \n", Day: " 5 ", Month: " 3", Year: "2024 "},
+			want: Todo{Title: "Buy milk", Description: "Semi-skimmed", Day: "05", Month: "03", Year: "2024"},
+		},
+		{
+			name: "collapses whitespace in the title",
+			todo: Todo{Title: "Buy\t\tsome \n milk"},
+			want: Todo{Title: "Buy some milk"},
+		},
+		{
+			name: "keeps line breaks in the description",
+			todo: Todo{Description: "one\n\ntwo"},
+			want: Todo{Description: "one\n\ntwo"},
+		},
+		{
+			name: "drops control characters from the title",
+			todo: Todo{Title: "sp\x01am\x7f"},
+			want: Todo{Title: "spam"},
+		},
+		{
+			name: "drops control characters without doubling spaces",
+			todo: Todo{Title: "a \x00 b"},
+			want: Todo{Title: "a b"},
+		},
+		{
+			name: "composes the title and description",
+			todo: Todo{Title: "cafe\u0301", Description: "nai\u0308ve"},
+			want: Todo{Title: "caf\u00e9", Description: "na\u00efve"},
+		},
+		{
+			name: "clamps a day past the end of the month",
+			todo: Todo{Day: "30", Month: "2", Year: "2024"},
+			want: Todo{Day: "29", Month: "02", Year: "2024"},
+		},
+		{
+			name: "clamps a day past the end of the month outside leap years",
+			todo: Todo{Day: "29", Month: "02", Year: "2023"},
+			want: Todo{Day: "28", Month: "02", Year: "2023"},
+		},
+		{
+			name: "clamps the month and a zero day",
+			todo: Todo{Day: "0", Month: "13", Year: "2024"},
+			want: Todo{Day: "01", Month: "12", Year: "2024"},
+		},
+		{
+			name: "clamps the year",
+			todo: Todo{Day: "1", Month: "1", Year: "0"},
+			want: Todo{Day: "01", Month: "01", Year: "0001"},
+		},
+		{
+			name: "pads a part sent on its own",
+			todo: Todo{Day: "5"},
+			want: Todo{Day: "05"},
+		},
+		{
+			name: "leaves a due date that isn't numbers alone",
+			todo: Todo{Day: "soon", Month: "3", Year: ""},
+			want: Todo{Day: "soon", Month: "03", Year: ""},
+		},
+		{
+			name: "leaves an empty todo empty",
+			todo: Todo{},
+			want: Todo{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			todo := test.todo
+			todo.Normalize()
+			if !reflect.DeepEqual(todo, test.want) {
+				t.Errorf("Normalize(%+v) = %+v, want %+v", test.todo, todo, test.want)
+			}
+			// Normalizing has to be idempotent, since todos are normalized both before the
+			// content filter and when they are saved.
+			again := todo
+			again.Normalize()
+			if !reflect.DeepEqual(again, todo) {
+				t.Errorf("Normalize isn't idempotent: %+v became %+v", todo, again)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Pomodoro is a session of focused work on a todo.
+type Pomodoro struct {
+	ID        int64     `json:"id" db:"id"`
+	TodoID    int64     `json:"todo_id" db:"todo_id"`
+	StartedAt time.Time `json:"started_at" db:"started_at"`
+	// CompletedAt is nil while the pomodoro is running.
+	CompletedAt *time.Time `json:"completed_at" db:"completed_at"`
+}
+
+// FocusDay is the focus time spent on all todos on one day. A pomodoro counts towards the day
+// it was completed on.
+type FocusDay struct {
+	// Date is the day as YYYY-MM-DD, in the server's time zone.
+	Date         string `json:"date" db:"date"`
+	Pomodoros    int64  `json:"pomodoros" db:"pomodoros"`
+	FocusSeconds int64  `json:"focus_seconds" db:"focus_seconds"`
+}
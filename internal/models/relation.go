@@ -0,0 +1,21 @@
+package models
+
+// The kinds of relation there can be between two todos.
+const (
+	// RelationRelated links two todos that have something to do with each other.
+	RelationRelated = "related"
+	// RelationDuplicateOf marks a todo as a duplicate of another.
+	RelationDuplicateOf = "duplicate_of"
+	// RelationDuplicatedBy is how a RelationDuplicateOf looks from the other todo. It can't be
+	// created directly.
+	RelationDuplicatedBy = "duplicated_by"
+)
+
+// Relation is a link from one todo to another, as seen from the first todo. A relation
+// between two todos shows up on both of them: if A is a duplicate of B, A has a
+// `duplicate_of` relation to B and B has a `duplicated_by` relation to A, with the same ID.
+type Relation struct {
+	ID     int64  `json:"id" db:"id"`
+	Kind   string `json:"kind" db:"kind"`
+	TodoID int64  `json:"todo_id" db:"todo_id"`
+}
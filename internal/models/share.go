@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Share is a public link to a todo. Anyone with the link can view the todo, without being
+// able to change it, until the share expires or is revoked.
+type Share struct {
+	ID     int64  `json:"id" db:"id"`
+	TodoID int64  `json:"todo_id" db:"todo_id"`
+	Token  string `json:"token" db:"token"`
+	// URL is the path the todo can be viewed at. It isn't stored since it is built from the
+	// token.
+	URL       string     `json:"url" db:"-"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at" db:"revoked_at"`
+	// Views is how many times the todo has been viewed through this share.
+	Views     int64     `json:"views" db:"views"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
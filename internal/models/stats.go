@@ -0,0 +1,8 @@
+package models
+
+// TodoStats holds aggregate counts over all todos.
+type TodoStats struct {
+	Total     int64 `json:"total" db:"total"`
+	Completed int64 `json:"completed" db:"completed"`
+	Open      int64 `json:"open" db:"open"`
+}
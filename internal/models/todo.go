@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Todo is the model we use for encapsulating an individual todo. The tags you see are
 // called "struct tags". They give metadata information that can help certain operations.
 //
@@ -11,11 +13,132 @@ package models
 // specify different names if we want to (e.g. if the completed column in the db was "done" we
 // could do `db:"done"` for the `Completed` field).
 type Todo struct {
-	ID          int64          `json:"id" db:"id"`
-	Title       string `json:"title" db:"title"`
-	Day         string `json:"day" db:"day"`
-	Month       string `json:"month" db:"month"`
-	Year        string `json:"year" db:"year"`
-	Completed   bool   `json:"completed" db:"completed"`
-	Description string `json:"description" db:"description"`
+	ID    int64  `json:"id" db:"id"`
+	Title string `json:"title" db:"title"`
+	Day   string `json:"day" db:"day"`
+	Month string `json:"month" db:"month"`
+	Year  string `json:"year" db:"year"`
+	// DueDate is the due date as YYYY-MM-DD, the same date as Day, Month and Year in the
+	// format clients are moving to. It isn't stored: in requests it is copied into the other
+	// three fields, and in responses it is filled in from them by ComputeFields.
+	DueDate     *string `json:"due_date" db:"-"`
+	Completed   bool    `json:"completed" db:"completed"`
+	Description string  `json:"description" db:"description"`
+	// Starred todos are shown before all others in lists.
+	Starred bool `json:"starred" db:"starred"`
+	// CreatedAt is when the todo was created. Todos created before this was recorded have the
+	// time it started being recorded.
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	// CompletedAt is when the todo was last marked as completed. It is a pointer so that it
+	// can be nil (NULL in the database) for todos that aren't completed.
+	CompletedAt *time.Time `json:"completed_at" db:"completed_at"`
+	// CustomFields holds the values of the custom fields defined by admins, keyed by name.
+	CustomFields JSONObject `json:"custom_fields" db:"custom_fields"`
+	// Metadata is freeform data for integrations. It can be set when a todo is created, but
+	// after that only changed through the metadata endpoint. It is left out of lists unless
+	// asked for with `?expand=metadata`.
+	Metadata JSONObject `json:"metadata,omitempty" db:"metadata"`
+	// Latitude and Longitude are where the todo should be done, if anywhere, and
+	// RadiusMeters how close counts as being there. They are set together or not at all.
+	Latitude     *float64 `json:"latitude" db:"latitude"`
+	Longitude    *float64 `json:"longitude" db:"longitude"`
+	RadiusMeters *int     `json:"radius_meters" db:"radius_meters"`
+	// FlagReason is set when the content filter flagged the todo for an admin to review, and
+	// nil otherwise. It is set by the server, never by clients.
+	FlagReason *string `json:"flag_reason,omitempty" db:"flag_reason"`
+
+	// Unchanged is set on the response to an update that didn't change anything, which
+	// tells clients they don't need to refresh anything else. It is never stored.
+	Unchanged bool `json:"unchanged,omitempty" db:"-"`
+
+	// Relations are the todo's links to other todos. They live in their own table, so the `-`
+	// tells sqlx there is no column for them; they are only loaded when fetching a single todo,
+	// or a list with `?expand=relations`.
+	Relations []*Relation `json:"relations,omitempty" db:"-"`
+
+	// The fields below aren't stored; they're worked out by ComputeFields just before the todo
+	// is sent to a client, so that every client shows the same values.
+
+	// Overdue is true if the todo isn't completed and its due date has passed.
+	Overdue bool `json:"overdue" db:"-"`
+	// DaysUntilDue is the number of days until the todo is due, negative once it is overdue.
+	// It is nil if the todo has no due date.
+	DaysUntilDue *int `json:"days_until_due" db:"-"`
+}
+
+// Due returns the date the todo is due, in the given location. The second value is false if
+// the todo doesn't have a (valid) due date.
+func (t *Todo) Due(loc *time.Location) (time.Time, bool) {
+	due, err := time.ParseInLocation("2006-1-2", t.Year+"-"+t.Month+"-"+t.Day, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return due, true
+}
+
+// ComputeFields fills in the fields that are derived from the others, as of the given time.
+func (t *Todo) ComputeFields(now time.Time) {
+	t.Overdue = false
+	t.DaysUntilDue = nil
+	t.DueDate = nil
+
+	due, ok := t.Due(now.Location())
+	if !ok {
+		return
+	}
+	dueDate := due.Format("2006-01-02")
+	t.DueDate = &dueDate
+	// We compare whole days, so we use midnight at the start of today rather than right now.
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	// Rounding takes care of days that aren't exactly 24 hours long because of daylight
+	// saving time.
+	days := int(due.Sub(today).Round(24*time.Hour) / (24 * time.Hour))
+	t.DaysUntilDue = &days
+	t.Overdue = !t.Completed && days < 0
+}
+
+// TodoSummary is a compact version of a Todo for list views. Descriptions can be long, and a
+// list rarely shows more than the start of one, so it is cut short and the rest left out.
+type TodoSummary struct {
+	ID          int64   `json:"id"`
+	Title       string  `json:"title"`
+	Day         string  `json:"day"`
+	Month       string  `json:"month"`
+	Year        string  `json:"year"`
+	DueDate     *string `json:"due_date"`
+	Completed   bool    `json:"completed"`
+	Starred     bool    `json:"starred"`
+	Description string  `json:"description"`
+	// DescriptionTruncated tells clients whether they need to fetch the full todo to show the
+	// whole description.
+	DescriptionTruncated bool `json:"description_truncated"`
+	Overdue              bool `json:"overdue"`
+	DaysUntilDue         *int `json:"days_until_due"`
+}
+
+// Summary returns the summary of the todo, keeping at most maxDescription characters of the
+// description. A negative maximum is treated as zero.
+func (t *Todo) Summary(maxDescription int) *TodoSummary {
+	if maxDescription < 0 {
+		maxDescription = 0
+	}
+	summary := &TodoSummary{
+		ID:           t.ID,
+		Title:        t.Title,
+		Day:          t.Day,
+		Month:        t.Month,
+		Year:         t.Year,
+		DueDate:      t.DueDate,
+		Completed:    t.Completed,
+		Starred:      t.Starred,
+		Description:  t.Description,
+		Overdue:      t.Overdue,
+		DaysUntilDue: t.DaysUntilDue,
+	}
+	// We count runes rather than bytes so that we never cut a multi-byte character in half.
+	if runes := []rune(t.Description); len(runes) > maxDescription {
+		summary.Description = string(runes[:maxDescription])
+		summary.DescriptionTruncated = true
+	}
+	return summary
 }
@@ -0,0 +1,25 @@
+package models
+
+import "testing"
+
+func TestSummary(t *testing.T) {
+	todo := &Todo{ID: 1, Title: "Buy milk", Description: "Café au lait"}
+	tests := []struct {
+		max       int
+		want      string
+		truncated bool
+	}{
+		{max: 20, want: "Café au lait"},
+		{max: 12, want: "Café au lait"},
+		{max: 4, want: "Café", truncated: true},
+		{max: 0, want: "", truncated: true},
+		{max: -1, want: "", truncated: true},
+	}
+	for _, test := range tests {
+		summary := todo.Summary(test.max)
+		if summary.Description != test.want || summary.DescriptionTruncated != test.truncated {
+			t.Errorf("Summary(%d) = %q (truncated %v), want %q (truncated %v)", test.max,
+				summary.Description, summary.DescriptionTruncated, test.want, test.truncated)
+		}
+	}
+}
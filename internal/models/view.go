@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ListView is a named set of parameters for the todo list that a client saved, so that the
+// same list follows its user from one device to another. GET /api/todos?view=<name> uses the
+// view's parameters for any the request leaves out.
+type ListView struct {
+	// ClientID is the client the view belongs to. It comes from the X-Client-ID header and is
+	// never sent back.
+	ClientID string `json:"-" db:"client_id"`
+	Name     string `json:"name" db:"name"`
+	// Sort is the order of the list, written like the `sort` query parameter.
+	Sort string `json:"sort" db:"sort"`
+	// Filters are the custom field filters, keyed by field name, like the `cf.<name>` query
+	// parameters.
+	Filters JSONObject `json:"filters" db:"filters"`
+	// PageSize is the number of todos per page. Zero means the default page size.
+	PageSize int `json:"page_size" db:"page_size"`
+	// Layout is `full` or `summary`, like the built-in views. Empty means full.
+	Layout    string    `json:"layout" db:"layout"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
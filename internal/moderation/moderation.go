@@ -0,0 +1,153 @@
+// Package moderation checks the content of todos before they are saved, so that deployments
+// where todos can be shared publicly can keep abusive content out.
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"ls-todo/internal/config"
+	"ls-todo/internal/models"
+)
+
+// defaultTimeout is used by New when CONTENT_FILTER_TIMEOUT is zero, since an http.Client
+// without a timeout would let a hung service hold requests open forever.
+const defaultTimeout = 2 * time.Second
+
+// Action is what should happen to a todo that has been checked.
+type Action string
+
+const (
+	// Allow saves the todo as usual.
+	Allow Action = "allow"
+	// Flag saves the todo but marks it for an admin to review. Flagged todos can't be viewed
+	// through share links until an admin clears the flag.
+	Flag Action = "flag"
+	// Reject refuses to save the todo.
+	Reject Action = "reject"
+)
+
+// Verdict is the result of checking a todo.
+type Verdict struct {
+	Action Action `json:"action"`
+	// Reason explains a flag or rejection. It is shown to admins reviewing flagged todos, and
+	// sent back to the client when a todo is rejected.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Filter decides whether a todo's content is acceptable. For updates, only the fields being
+// changed are filled in.
+type Filter interface {
+	Check(ctx context.Context, todo *models.Todo) (Verdict, error)
+}
+
+// New returns the Filter described by the config: the external API if CONTENT_FILTER_URL is
+// set, otherwise the regular expressions if either is set, otherwise a filter that allows
+// everything.
+func New(cfg *config.Config) (Filter, error) {
+	if cfg.ContentFilterURL != "" {
+		timeout := cfg.ContentFilterTimeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		return &apiFilter{url: cfg.ContentFilterURL, client: &http.Client{Timeout: timeout}}, nil
+	}
+	if cfg.ContentFilterReject == "" && cfg.ContentFilterFlag == "" {
+		return allowAll{}, nil
+	}
+
+	filter := &regexFilter{}
+	var err error
+	if filter.reject, err = compile(cfg.ContentFilterReject); err != nil {
+		return nil, fmt.Errorf("invalid CONTENT_FILTER_REJECT: %w", err)
+	}
+	if filter.flag, err = compile(cfg.ContentFilterFlag); err != nil {
+		return nil, fmt.Errorf("invalid CONTENT_FILTER_FLAG: %w", err)
+	}
+	return filter, nil
+}
+
+// compile compiles a case-insensitive regular expression, or returns nil for an empty one.
+func compile(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// allowAll implements Filter by allowing every todo. It is used when no filter is configured.
+type allowAll struct{}
+
+func (allowAll) Check(context.Context, *models.Todo) (Verdict, error) {
+	return Verdict{Action: Allow}, nil
+}
+
+// regexFilter implements Filter by matching the title and description against regular
+// expressions. Either expression may be nil.
+type regexFilter struct {
+	reject *regexp.Regexp
+	flag   *regexp.Regexp
+}
+
+func (f *regexFilter) Check(_ context.Context, todo *models.Todo) (Verdict, error) {
+	text := todo.Title + "\n" + todo.Description
+	// We deliberately don't say what matched: echoing a blocked word back would only help
+	// someone find a way around the list.
+	if f.reject != nil && f.reject.MatchString(text) {
+		return Verdict{Action: Reject, Reason: "blocked content"}, nil
+	}
+	if f.flag != nil && f.flag.MatchString(text) {
+		return Verdict{Action: Flag, Reason: "matched the flag list"}, nil
+	}
+	return Verdict{Action: Allow}, nil
+}
+
+// apiFilter implements Filter by asking an external moderation service. The service is sent
+// `{"title": ..., "description": ...}` and must answer with a Verdict.
+type apiFilter struct {
+	url    string
+	client *http.Client
+}
+
+// apiRequest is the body sent to the moderation service.
+type apiRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+func (f *apiFilter) Check(ctx context.Context, todo *models.Todo) (Verdict, error) {
+	body, err := json.Marshal(apiRequest{Title: todo.Title, Description: todo.Description})
+	if err != nil {
+		return Verdict{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", f.url, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("content filter returned status %d", resp.StatusCode)
+	}
+
+	var verdict Verdict
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return Verdict{}, fmt.Errorf("decoding content filter response: %w", err)
+	}
+	switch verdict.Action {
+	case Allow, Flag, Reject:
+		return verdict, nil
+	default:
+		return Verdict{}, fmt.Errorf("content filter returned unknown action %q", verdict.Action)
+	}
+}
@@ -0,0 +1,153 @@
+package reporting
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Reporter sends unexpected errors somewhere they can be looked at later. Only errors that
+// indicate a bug or an outage should be reported (panics and 5xx responses), not errors caused
+// by bad client input.
+type Reporter interface {
+	// Report reports an error that happened while handling the given request. The request may
+	// be nil for errors that happen outside of a request (e.g. in a background job).
+	Report(err error, r *http.Request)
+}
+
+// New returns the Reporter described by the DSN. If the DSN is empty, errors are just logged.
+func New(dsn, environment, release string) (Reporter, error) {
+	if dsn == "" {
+		return logReporter{}, nil
+	}
+	return newSentryReporter(dsn, environment, release)
+}
+
+// logReporter implements Reporter by writing errors to the log.
+type logReporter struct{}
+
+func (logReporter) Report(err error, r *http.Request) {
+	if r == nil {
+		slog.Error("unexpected error", "error", err)
+		return
+	}
+	slog.Error("error handling request", "method", r.Method, "path", r.URL.Path, "error", err)
+}
+
+// sentryReporter implements Reporter by sending errors to Sentry (or anything that speaks
+// Sentry's store API).
+type sentryReporter struct {
+	endpoint    string
+	auth        string
+	environment string
+	release     string
+	client      *http.Client
+}
+
+// newSentryReporter parses a DSN of the form `https://<key>@<host>/<project>`.
+func newSentryReporter(dsn, environment, release string) (*sentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry DSN: %w", err)
+	}
+	project := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || project == "" {
+		return nil, fmt.Errorf("invalid sentry DSN: expected https://<key>@<host>/<project>")
+	}
+	return &sentryReporter{
+		endpoint:    fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=ls-todo/1.0, sentry_key=%s", u.User.Username()),
+		environment: environment,
+		release:     release,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+// sentryEvent is the subset of Sentry's event payload that we fill in.
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Message     string            `json:"message"`
+	Exception   *sentryExceptions `json:"exception"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sentryRequest struct {
+	URL         string `json:"url"`
+	Method      string `json:"method"`
+	QueryString string `json:"query_string,omitempty"`
+}
+
+func (s *sentryReporter) Report(err error, r *http.Request) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	event := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       "error",
+		Platform:    "go",
+		Environment: s.environment,
+		Release:     s.release,
+		Message:     err.Error(),
+		Exception: &sentryExceptions{Values: []sentryException{
+			{Type: fmt.Sprintf("%T", err), Value: err.Error()},
+		}},
+	}
+	// We deliberately leave out headers and bodies, since they may contain credentials or
+	// personal data.
+	if r != nil {
+		event.Request = &sentryRequest{URL: r.URL.Path, Method: r.Method, QueryString: r.URL.RawQuery}
+	}
+
+	// Reporting happens in the background so that a slow (or down) Sentry doesn't slow down
+	// our responses.
+	go func() {
+		if err := s.send(event); err != nil {
+			slog.Error("error reporting to sentry", "error", err)
+		}
+	}()
+}
+
+// send posts an event to Sentry.
+func (s *sentryReporter) send(event sentryEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
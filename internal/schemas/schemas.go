@@ -0,0 +1,57 @@
+// Package schemas holds the JSON Schemas describing the API's request and response bodies.
+// Clients can fetch them from /api/schemas to generate models or validate payloads before
+// sending them.
+package schemas
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+)
+
+// Like the i18n catalogs, the schemas are embedded so that they ship with the binary.
+//
+//go:embed files/*.json
+var files embed.FS
+
+// schemas maps a schema's file name (e.g. "todo.json") to its contents.
+var schemas = loadSchemas()
+
+// loadSchemas reads the embedded schemas. A schema that isn't valid JSON is a bug in the build,
+// so we panic rather than serve it.
+func loadSchemas() map[string][]byte {
+	entries, err := files.ReadDir("files")
+	if err != nil {
+		panic(err)
+	}
+	result := map[string][]byte{}
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("files", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		if !json.Valid(data) {
+			panic(fmt.Sprintf("invalid schema %s", entry.Name()))
+		}
+		result[entry.Name()] = data
+	}
+	return result
+}
+
+// Names returns the file names of all of the schemas, sorted.
+func Names() []string {
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the schema with the given file name, and false if there isn't one.
+func Get(name string) ([]byte, bool) {
+	data, ok := schemas[name]
+	return data, ok
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The formats the access log can be written in.
+const (
+	// AccessLogCombined is the Apache/NCSA combined log format, understood by most log tooling.
+	AccessLogCombined = "combined"
+	// AccessLogJSON writes one JSON object per request.
+	AccessLogJSON = "json"
+	// AccessLogOff disables the access log.
+	AccessLogOff = "off"
+)
+
+// statusRecorder wraps a ResponseWriter to remember the status code and the number of bytes
+// written, which the ResponseWriter doesn't let us read back.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	// If a handler writes a body without calling WriteHeader first, net/http sends a 200.
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// accessLogEntry is a single line of the JSON access log.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int       `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// AccessLog returns a middleware that writes a line to w for every request, in the given format
+// (one of the AccessLog constants). It is kept separate from the application log so that it
+// can be sent somewhere else, like a file read by log tooling.
+func AccessLog(w io.Writer, format string) (func(http.Handler) http.Handler, error) {
+	if format != AccessLogCombined && format != AccessLogJSON && format != AccessLogOff {
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+	// Requests are handled concurrently, so we need a lock to stop lines from different
+	// requests getting interleaved.
+	var mu sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		if format == AccessLogOff {
+			return next
+		}
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: rw}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+
+			var line []byte
+			if format == AccessLogJSON {
+				line, _ = json.Marshal(accessLogEntry{
+					Time:       start,
+					RemoteAddr: host,
+					Method:     r.Method,
+					Path:       loggedURI(r),
+					Proto:      r.Proto,
+					Status:     rec.status,
+					Bytes:      rec.bytes,
+					DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+					Referer:    r.Referer(),
+					UserAgent:  r.UserAgent(),
+				})
+				line = append(line, '\n')
+			} else {
+				line = []byte(combinedLine(host, start, r, rec))
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			_, _ = w.Write(line)
+		})
+	}, nil
+}
+
+// combinedLine formats a request in the combined log format:
+//
+//	host ident user [time] "request line" status bytes "referer" "user agent"
+//
+// We don't have an ident or an authenticated user, so those are always "-". A missing
+// referer or user agent is written as "-" too, as Apache does, rather than as "".
+func combinedLine(host string, start time.Time, r *http.Request, rec *statusRecorder) string {
+	size := "-"
+	if rec.bytes > 0 {
+		size = fmt.Sprint(rec.bytes)
+	}
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s %q %q\n",
+		host,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, loggedURI(r), r.Proto,
+		rec.status,
+		size,
+		orDash(r.Referer()),
+		orDash(r.UserAgent()),
+	)
+}
+
+// inboundEmailPath is the prefix of the inbound email route, whose last segment is a secret.
+const inboundEmailPath = "/api/inbound/email/"
+
+// loggedURI returns the request URI to write to the access log. The inbound email token is
+// replaced with "-", since anyone who can read the log could otherwise post emails as todos.
+func loggedURI(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, inboundEmailPath) {
+		u := *r.URL
+		u.Path, u.RawPath = inboundEmailPath+"-", ""
+		return u.RequestURI()
+	}
+	return r.URL.RequestURI()
+}
+
+// orDash returns s, or "-" if it is empty, which is how the combined log format marks a
+// missing value.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
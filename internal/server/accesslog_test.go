@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCombinedAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	accessLog, err := AccessLog(&buf, AccessLogCombined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	tests := []struct {
+		referer, userAgent string
+		want               string
+	}{
+		{"", "", `"GET /api/todos HTTP/1.1" 200 2 "-" "-"`},
+		{"https://example.com/", "curl/8.0", `"GET /api/todos HTTP/1.1" 200 2 "https://example.com/" "curl/8.0"`},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		r := httptest.NewRequest("GET", "/api/todos", nil)
+		r.Header.Set("Referer", test.referer)
+		r.Header.Set("User-Agent", test.userAgent)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if line := strings.TrimSuffix(buf.String(), "\n"); !strings.HasSuffix(line, test.want) {
+			t.Errorf("referer %q, user agent %q: line %q, want it to end with %q",
+				test.referer, test.userAgent, line, test.want)
+		}
+	}
+}
+
+func TestAccessLogRedactsInboundEmailToken(t *testing.T) {
+	for _, format := range []string{AccessLogCombined, AccessLogJSON} {
+		var buf bytes.Buffer
+		accessLog, err := AccessLog(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/inbound/email/s3cret?x=1", nil))
+		if line := buf.String(); strings.Contains(line, "s3cret") || !strings.Contains(line, "/api/inbound/email/-?x=1") {
+			t.Errorf("%s: line %q, want the token replaced with -", format, line)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"ls-todo/internal/db"
+	"ls-todo/internal/jobs"
+	"ls-todo/internal/logging"
+	"ls-todo/internal/models"
+	"ls-todo/internal/version"
+)
+
+// requireAdmin wraps a handler so that it can only be called with the admin token in the
+// `Authorization: Bearer <token>` header. If no admin token is configured, the admin endpoints
+// are disabled entirely and we pretend they don't exist.
+func (s *server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AdminToken == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// `TrimPrefix` would leave a header without the prefix as it is, so a bare token
+		// would be accepted too. We only accept the documented form.
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// A regular string comparison returns as soon as it finds a mismatched byte, which
+		// means an attacker could work out the token one byte at a time by timing responses.
+		// `ConstantTimeCompare` always takes the same amount of time.
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *server) HandleGetReports(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(s.reports.Reports()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleRunReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Clients can ask for fewer rows than the configured limit, but never more.
+	limit := s.cfg.ReportRowLimit
+	query := r.URL.Query()
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, "invalid_limit", "")
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+	// The remaining query parameters are passed to the report. We only take the first value
+	// of each since reports don't accept lists.
+	params := map[string]string{}
+	for key := range query {
+		params[key] = query.Get(key)
+	}
+
+	// Reports can be slow, so we cache them. `Encode` sorts the parameters, so the same
+	// report with the same parameters always gets the same key.
+	key := fmt.Sprintf("report:%s:%d:%s", vars["name"], limit, query.Encode())
+	body, etag, err := s.statsCache.Get(key, func() ([]byte, error) {
+		results, err := s.reports.RunReport(vars["name"], params, limit)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(results)
+	})
+	if errors.Is(err, db.ErrUnknownReport) {
+		writeError(w, r, http.StatusNotFound, "unknown_report", vars["name"])
+		return
+	}
+	if errors.Is(err, db.ErrInvalid) {
+		writeError(w, r, http.StatusBadRequest, "invalid_report_params", err.Error())
+		return
+	}
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	s.writeCached(w, r, body, etag)
+}
+
+// retentionPreview is the response body for HandleRetentionPreview.
+type retentionPreview struct {
+	CompletedBefore time.Time      `json:"completed_before"`
+	Todos           []*models.Todo `json:"todos"`
+}
+
+func (s *server) HandleRetentionPreview(w http.ResponseWriter, r *http.Request) {
+	cutoff, ok := s.cfg.RetentionCutoff(s.clock.Now())
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "retention_disabled", "")
+		return
+	}
+
+	todos, err := s.db.GetExpiredTodos(cutoff)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(retentionPreview{CompletedBefore: cutoff, Todos: todos}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// stats is the response body for HandleGetStats.
+type stats struct {
+	Version       version.Info      `json:"version"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Goroutines    int               `json:"goroutines"`
+	Todos         *models.TodoStats `json:"todos"`
+	// SlowQueries is how many database queries have been slower than SLOW_QUERY_THRESHOLD
+	// since the server started.
+	SlowQueries int64 `json:"slow_queries"`
+	// Schema is the version of the migrations applied to the database.
+	Schema *db.SchemaVersion `json:"schema"`
+	// Focus is the focus time spent in pomodoros on each of the last week's days.
+	Focus []*models.FocusDay `json:"focus"`
+}
+
+func (s *server) HandleGetStats(w http.ResponseWriter, r *http.Request) {
+	body, etag, err := s.statsCache.Get("stats", func() ([]byte, error) {
+		todoStats, err := s.db.GetTodoStats()
+		if err != nil {
+			return nil, err
+		}
+		focus, err := s.db.GetFocusDays(defaultFocusDays, s.loc)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := s.db.GetSchemaVersion()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(stats{
+			Version:       version.Get(),
+			UptimeSeconds: int64(time.Since(s.started).Seconds()),
+			Goroutines:    runtime.NumGoroutine(),
+			Todos:         todoStats,
+			SlowQueries:   db.SlowQueries(),
+			Schema:        schema,
+			Focus:         focus,
+		})
+	})
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	s.writeCached(w, r, body, etag)
+}
+
+func (s *server) HandleGetDiagnostics(w http.ResponseWriter, r *http.Request) {
+	// Unlike the stats, diagnostics aren't cached: they're used while something is going
+	// wrong, when a 30 second old snapshot isn't much help.
+	diagnostics, err := s.db.GetDiagnostics()
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(diagnostics); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleGetJobs(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(jobs.Runs(s.clock)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleGetJobLeaders(w http.ResponseWriter, r *http.Request) {
+	// Every instance registers the same jobs, so this one's list covers the whole
+	// deployment.
+	runs := jobs.Runs(s.clock)
+	names := make([]string, 0, len(runs))
+	for _, run := range runs {
+		names = append(names, run.Name)
+	}
+
+	leaders, err := s.db.GetJobLeaders(names)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(leaders); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// logLevel is the request and response body for the loglevel endpoints.
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func (s *server) HandleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	level := logLevel{Level: strings.ToLower(logging.Level.Level().String())}
+	if err := json.NewEncoder(w).Encode(level); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var body logLevel
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(body.Level)); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_level", "")
+		return
+	}
+
+	previous := logging.Level.Level()
+	logging.Level.Set(level)
+	// We log at warn so the change shows up regardless of the level it was changed to.
+	slog.Warn("log level changed", "from", previous, "to", level)
+
+	s.HandleGetLogLevel(w, r)
+}
+
+func (s *server) HandleGetCustomFields(w http.ResponseWriter, r *http.Request) {
+	definitions, err := s.db.GetCustomFields()
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(definitions); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandlePutCustomField(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var definition models.CustomFieldDefinition
+	if err := json.NewDecoder(r.Body).Decode(&definition); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	// The name in the path wins over any name in the body.
+	definition.Name = vars["name"]
+	if definition.Type == models.CustomFieldSelect && len(definition.Options) == 0 {
+		writeError(w, r, http.StatusUnprocessableEntity, "invalid", "a select field needs options")
+		return
+	}
+
+	saved, err := s.db.PutCustomField(&definition)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(saved); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleDeleteCustomField(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	definition, err := s.db.DeleteCustomField(vars["name"])
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if definition == nil {
+		writeError(w, r, http.StatusNotFound, "custom_field_not_found", "")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(definition); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
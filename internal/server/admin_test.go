@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ls-todo/internal/config"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	s := &server{cfg: &config.Config{AdminToken: "secret"}}
+	handler := s.requireAdmin(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := map[string]int{
+		"Bearer secret": http.StatusOK,
+		"secret":        http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Basic secret":  http.StatusUnauthorized,
+		"":              http.StatusUnauthorized,
+	}
+	for header, want := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/admin/reports", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		handler(w, r)
+		if w.Code != want {
+			t.Errorf("Authorization %q: status = %d, want %d", header, w.Code, want)
+		}
+	}
+}
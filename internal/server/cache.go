@@ -0,0 +1,22 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// writeCached sends a cached JSON body along with the headers that let clients (and proxies)
+// cache it too. If the client already has this version of the body, as indicated by the
+// If-None-Match header matching the ETag, we send a 304 without a body instead.
+func (s *server) writeCached(w http.ResponseWriter, r *http.Request, body []byte, etag string) {
+	h := w.Header()
+	h.Set("ETag", etag)
+	// `private` stops shared caches (like a CDN) from storing responses meant for admins.
+	h.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(s.statsCache.TTL().Seconds())))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"ls-todo/internal/models"
+)
+
+// dueDateLayout is the format of the due_date field.
+const dueDateLayout = "2006-01-02"
+
+// legacyDueFields are the fields the due date used to be sent in, before due_date existed.
+var legacyDueFields = []string{"day", "month", "year"}
+
+// decodeTodo reads a todo from the request body. Clients can send the due date either as the
+// legacy day, month and year fields or as due_date; we accept both and store due_date in the
+// legacy fields, so the rest of the code only deals with one form.
+//
+// In strict mode the legacy fields are rejected, so clients can check that they have moved to
+// due_date before the legacy fields are removed. A client opts in with the standard
+// `Prefer: handling=strict` header, and STRICT_REQUEST_FIELDS turns it on for everyone.
+func (s *server) decodeTodo(w http.ResponseWriter, r *http.Request) (*models.Todo, error) {
+	// We need to decode the body twice: once into a map to see which fields were sent, and
+	// once into the todo. So we read it all first.
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, paramError("invalid_body")
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, paramError("invalid_body")
+	}
+	var todo models.Todo
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&todo); err != nil {
+		return nil, paramError("invalid_body")
+	}
+
+	legacy := false
+	for _, field := range legacyDueFields {
+		if _, ok := fields[field]; ok {
+			legacy = true
+		}
+	}
+	if s.strict(r) {
+		// Preference-Applied tells the client its preference was honoured.
+		w.Header().Set("Preference-Applied", "handling=strict")
+		if legacy {
+			return nil, paramError("legacy_fields")
+		}
+	}
+
+	if todo.DueDate == nil {
+		return &todo, nil
+	}
+	due, err := time.Parse(dueDateLayout, *todo.DueDate)
+	if err != nil {
+		return nil, paramError("invalid_due_date")
+	}
+	// Sending both forms is fine as long as they agree. If they don't, we can't know which
+	// one the client meant. We compare them as dates rather than as text, since older todos
+	// can have unpadded legacy fields (a day of "5" rather than "05") that a client sends
+	// back as it got them.
+	if legacy {
+		if legacyDue, ok := todo.Due(time.UTC); !ok || !legacyDue.Equal(due) {
+			return nil, paramError("invalid_due_date")
+		}
+	}
+	todo.Day, todo.Month, todo.Year = due.Format("02"), due.Format("01"), due.Format("2006")
+	return &todo, nil
+}
+
+// strict returns whether the request should be handled in strict mode.
+func (s *server) strict(r *http.Request) bool {
+	if s.cfg.StrictRequestFields {
+		return true
+	}
+	for _, preference := range strings.Split(r.Header.Get("Prefer"), ",") {
+		if strings.TrimSpace(preference) == "handling=strict" {
+			return true
+		}
+	}
+	return false
+}
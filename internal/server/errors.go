@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"ls-todo/internal/db"
+	"ls-todo/internal/i18n"
+)
+
+// apiError is the JSON body we send back when a request fails for a reason the client may be
+// able to do something about. The code is a stable, machine-readable identifier; the message
+// is meant for humans, is translated into the client's language, and may change. The detail,
+// when there is one, is extra technical information that isn't translated.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// paramError is returned by the functions that parse request parameters. Its value is the
+// error code to send back to the client.
+type paramError string
+
+func (e paramError) Error() string {
+	return string(e)
+}
+
+// writeError sends an error response with the given status and code. The message is looked up
+// from the code in the language the client asked for with the Accept-Language header.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	localizer := i18n.New(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", localizer.Language())
+	w.WriteHeader(status)
+	// There isn't much we can do if this fails since we have already written the status.
+	_ = json.NewEncoder(w).Encode(apiError{Code: code, Message: localizer.T(code), Detail: detail})
+}
+
+// writeParamError sends a 400 for an error returned while parsing request parameters.
+func writeParamError(w http.ResponseWriter, r *http.Request, err error) {
+	var pErr paramError
+	if errors.As(err, &pErr) {
+		writeError(w, r, http.StatusBadRequest, string(pErr), "")
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, "invalid", err.Error())
+}
+
+// writeDBError sends the appropriate response for an error returned by the database. Rather
+// than treating every failure as an ISE, we check whether the error was caused by the data the
+// client sent (or by a concurrent request) so they know whether trying again makes sense.
+//
+// Errors we can't classify are unexpected, so we report them before responding with an ISE.
+func (s *server) writeDBError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, db.ErrConflict):
+		writeError(w, r, http.StatusConflict, "conflict", err.Error())
+	case errors.Is(err, db.ErrInvalid):
+		writeError(w, r, http.StatusUnprocessableEntity, "invalid", err.Error())
+	case errors.Is(err, db.ErrRetryable):
+		// A 503 with a Retry-After header tells well-behaved clients that the request can be
+		// sent again as-is.
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, http.StatusServiceUnavailable, "retry", "")
+	default:
+		s.reporter.Report(err, r)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ls-todo/internal/clock"
+	"ls-todo/internal/db"
+	"ls-todo/internal/models"
+)
+
+// fixtures is the request body for HandleLoadFixtures. It describes the data a test wants to
+// start from.
+type fixtures struct {
+	CustomFields []*models.CustomFieldDefinition `json:"custom_fields"`
+	Todos        []*fixtureTodo                  `json:"todos"`
+	Relations    []*fixtureRelation              `json:"relations"`
+}
+
+// fixtureTodo is a todo to create. The key is a name the relations can refer to it by, since
+// its id isn't known until it is created.
+type fixtureTodo struct {
+	Key string `json:"key"`
+	models.Todo
+}
+
+// fixtureRelation is a relation to create between two fixture todos, given by their keys.
+type fixtureRelation struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// requireFixtures wraps a handler so that it only exists when test fixtures are enabled. These
+// endpoints can wipe the database, so they must never be reachable in production.
+func (s *server) requireFixtures(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.TestFixtures {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *server) HandleLoadFixtures(w http.ResponseWriter, r *http.Request) {
+	var body fixtures
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+
+	// Everything is loaded in one transaction, so a mistake in the fixtures leaves the
+	// database as it was rather than half loaded.
+	ids := map[string]int64{}
+	err := s.db.WithTx(r.Context(), func(tx db.PGManager) error {
+		for _, definition := range body.CustomFields {
+			if _, err := tx.PutCustomField(definition); err != nil {
+				return err
+			}
+		}
+		for _, todo := range body.Todos {
+			created, err := tx.CreateTodo(&todo.Todo)
+			if err != nil {
+				return err
+			}
+			if todo.Key != "" {
+				ids[todo.Key] = created.ID
+			}
+		}
+		for _, relation := range body.Relations {
+			from, ok := ids[relation.From]
+			if !ok {
+				return fmt.Errorf("%w: unknown todo key %q", db.ErrInvalid, relation.From)
+			}
+			to, ok := ids[relation.To]
+			if !ok {
+				return fmt.Errorf("%w: unknown todo key %q", db.ErrInvalid, relation.To)
+			}
+			if _, err := tx.CreateRelation(from, &models.Relation{Kind: relation.Kind, TodoID: to}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	// We send back the id each key was given, so the test can use them in its requests.
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(ids); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// testClock is the request and response body for the test clock endpoints.
+type testClock struct {
+	Now    time.Time `json:"now"`
+	Frozen bool      `json:"frozen"`
+	// Advance is a Go duration (e.g. "24h") to move the clock forward by. It is only used
+	// in requests.
+	Advance string `json:"advance,omitempty"`
+}
+
+func (s *server) HandleGetClock(w http.ResponseWriter, r *http.Request) {
+	body := testClock{Now: s.clock.Now()}
+	if fake, ok := s.clock.(*clock.Fake); ok {
+		body.Frozen = fake.Frozen()
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleSetClock(w http.ResponseWriter, r *http.Request) {
+	// The clock can only be changed if it's a fake one, which it always is when the test
+	// endpoints are enabled.
+	fake, ok := s.clock.(*clock.Fake)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var body testClock
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	// The whole body is checked before the clock is touched, so a bad request leaves it as
+	// it was.
+	var advance time.Duration
+	if body.Advance != "" {
+		d, err := time.ParseDuration(body.Advance)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+			return
+		}
+		advance = d
+	}
+	// A request can freeze the clock at a time, move it forward, or both (in that order).
+	if !body.Now.IsZero() {
+		fake.Set(body.Now)
+	}
+	if advance != 0 {
+		fake.Advance(advance)
+	}
+
+	s.HandleGetClock(w, r)
+}
+
+func (s *server) HandleResetClock(w http.ResponseWriter, r *http.Request) {
+	if fake, ok := s.clock.(*clock.Fake); ok {
+		fake.Reset()
+	}
+	s.HandleGetClock(w, r)
+}
+
+func (s *server) HandleResetFixtures(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteEverything(); err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
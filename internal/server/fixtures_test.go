@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"ls-todo/internal/clock"
+	"ls-todo/internal/config"
+)
+
+func TestSetClockLeavesClockOnBadRequest(t *testing.T) {
+	fake := clock.NewFake()
+	before := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	fake.Set(before)
+	s := &server{cfg: &config.Config{}, clock: fake}
+
+	tests := []struct {
+		body string
+		want int
+		now  time.Time
+	}{
+		{`{"now":"2030-01-01T00:00:00Z","advance":"soon"}`, http.StatusBadRequest, before},
+		{`{"now":"2030-01-01T00:00:00Z","advance":"1h"}`, http.StatusOK, time.Date(2030, 1, 1, 1, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		w := serve(http.HandlerFunc(s.HandleSetClock), "PUT", "/api/test/clock", test.body)
+		if w.Code != test.want {
+			t.Errorf("%s: status = %d, want %d", test.body, w.Code, test.want)
+		}
+		if now := fake.Now(); !now.Equal(test.now) {
+			t.Errorf("%s: clock = %v, want %v", test.body, now, test.now)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"ls-todo/internal/models"
+)
+
+// HandleInboundEmail turns an email into a todo. It accepts the form Mailgun (and services
+// that copy its format) posts for inbound mail: the subject becomes the title and the body the
+// description. The sender, the message id and the attachments' names, types and sizes
+// are kept in the todo's metadata under "email".
+func (s *server) HandleInboundEmail(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	// The token in the path is how we know the email came through our mail provider, since
+	// nobody else should know the URL. If no token is configured, ingestion is disabled.
+	if s.cfg.InboundEmailToken == "" ||
+		subtle.ConstantTimeCompare([]byte(vars["token"]), []byte(s.cfg.InboundEmailToken)) != 1 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	maxSize := s.cfg.InboundEmailMaxSizeMB << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	// Emails without attachments may be sent URL encoded rather than as multipart. The form
+	// is parsed either way, so that case isn't an error.
+	if err := r.ParseMultipartForm(maxSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	// The token in the URL can leak (e.g. into the provider's logs), so when a signing key is
+	// configured we also check the provider's signature, which also stops replays.
+	if s.cfg.InboundEmailSigningKey != "" && !s.checkMailgunSignature(r) {
+		writeError(w, r, http.StatusUnauthorized, "invalid_signature", "")
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("subject"))
+	if title == "" {
+		title = "(no subject)"
+	}
+	// The stripped text has quoted replies and signatures removed, which is what we want for
+	// a description. Not every provider sends it, so we fall back to the full body.
+	description := r.FormValue("stripped-text")
+	if description == "" {
+		description = r.FormValue("body-plain")
+	}
+
+	email := map[string]interface{}{
+		"from":       r.FormValue("from"),
+		"message_id": r.FormValue("Message-Id"),
+	}
+	// We have nowhere to store files yet, so only the details of each attachment are kept.
+	if r.MultipartForm != nil {
+		attachments := []map[string]interface{}{}
+		for _, files := range r.MultipartForm.File {
+			for _, file := range files {
+				attachments = append(attachments, map[string]interface{}{
+					"filename":     file.Filename,
+					"content_type": file.Header.Get("Content-Type"),
+					"size":         file.Size,
+				})
+			}
+		}
+		email["attachments"] = attachments
+	}
+
+	todo := &models.Todo{
+		Title:       title,
+		Description: description,
+		Metadata:    models.JSONObject{"email": email},
+	}
+	if !s.checkContent(w, r, todo) {
+		return
+	}
+	todo, err := s.db.CreateTodo(todo)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"ls-todo/internal/db"
+	"ls-todo/internal/models"
+)
+
+// The /api/integrations endpoints are shaped for no-code automation platforms like Zapier and
+// IFTTT. Triggers are polled: the platform fetches the latest items every few minutes and
+// works out which are new by their `id`, which is why each item's `id` identifies the event
+// rather than the todo. Actions take a flat JSON body and return the todo they acted on.
+
+// triggerItem is an item returned by a trigger endpoint.
+type triggerItem struct {
+	// ID is the deduplication id. The platform fires the trigger once for each id it hasn't
+	// seen before.
+	ID     string `json:"id"`
+	TodoID int64  `json:"todo_id"`
+	// Since ID is less deeply nested than the todo's own id field, it is the one that ends up
+	// in the JSON.
+	*models.Todo
+}
+
+// sampleTodo is what the triggers return with `?sample=true`. Platforms show it while a user is
+// setting up an automation, so they can map its fields even if there are no todos yet.
+var sampleTodo = &models.Todo{
+	ID:          1,
+	Title:       "Buy milk",
+	Day:         "01",
+	Month:       "02",
+	Year:        "2030",
+	Description: "Two litres, semi-skimmed",
+}
+
+// completeTodoAction is the request body for HandleCompleteTodoAction.
+type completeTodoAction struct {
+	TodoID int64 `json:"todo_id"`
+}
+
+// requireAPIKey wraps a handler so that it can only be called with the integration API key in
+// the X-API-Key header. If no key is configured, the integration endpoints are disabled.
+func (s *server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.IntegrationAPIKey == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		key := r.Header.Get("X-API-Key")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.IntegrationAPIKey)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *server) HandleNewTodosTrigger(w http.ResponseWriter, r *http.Request) {
+	s.writeTrigger(w, r, s.db.GetNewestTodos, func(todo *models.Todo) string {
+		return fmt.Sprint(todo.ID)
+	})
+}
+
+func (s *server) HandleCompletedTodosTrigger(w http.ResponseWriter, r *http.Request) {
+	// A todo can be completed, reopened and completed again. Including the completion time in
+	// the id makes each completion a new event.
+	s.writeTrigger(w, r, s.db.GetRecentlyCompletedTodos, func(todo *models.Todo) string {
+		if todo.CompletedAt == nil {
+			return fmt.Sprint(todo.ID)
+		}
+		return fmt.Sprintf("%d-%d", todo.ID, todo.CompletedAt.Unix())
+	})
+}
+
+func (s *server) HandleCreateTodoAction(w http.ResponseWriter, r *http.Request) {
+	todo, err := s.decodeTodo(w, r)
+	if err != nil {
+		writeParamError(w, r, err)
+		return
+	}
+	if !s.checkContent(w, r, todo) {
+		return
+	}
+
+	created, err := s.db.CreateTodo(todo)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	s.computeFields(created)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(created); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleCompleteTodoAction(w http.ResponseWriter, r *http.Request) {
+	var body completeTodoAction
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+
+	// Platforms retry actions that time out, so completing rather than toggling means a retry
+	// can't undo the first attempt.
+	todo, err := s.db.CompleteTodo(body.TodoID)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if todo == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	s.computeFields(todo)
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// writeTrigger sends the response for a trigger endpoint, listing the todos returned by list
+// with the deduplication id worked out by id.
+func (s *server) writeTrigger(w http.ResponseWriter, r *http.Request,
+	list func(db.ListOptions) ([]*models.Todo, error), id func(*models.Todo) string) {
+	var todos []*models.Todo
+	if r.URL.Query().Get("sample") == "true" {
+		sample := *sampleTodo
+		todos = []*models.Todo{&sample}
+	} else {
+		opts, err := parseListOptions(r)
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		if todos, err = list(opts); err != nil {
+			s.writeDBError(w, r, err)
+			return
+		}
+	}
+
+	s.computeFields(todos...)
+	items := make([]triggerItem, len(todos))
+	for i, todo := range todos {
+		items[i] = triggerItem{ID: id(todo), TodoID: todo.ID, Todo: todo}
+	}
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
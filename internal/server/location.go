@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// location is the request body for HandleReportLocation.
+type location struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+// HandleReportLocation takes a client's location and returns the open todos it is near, so the
+// client can remind its user about them. The location is only used to answer the request; it
+// isn't stored or logged. Clients should send a coarse location and only when it has changed
+// noticeably, since each report is a query.
+func (s *server) HandleReportLocation(w http.ResponseWriter, r *http.Request) {
+	var body location
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	if body.Latitude == nil || body.Longitude == nil ||
+		*body.Latitude < -90 || *body.Latitude > 90 ||
+		*body.Longitude < -180 || *body.Longitude > 180 {
+		writeError(w, r, http.StatusBadRequest, "invalid_location", "")
+		return
+	}
+
+	todos, err := s.db.GetNearbyTodos(*body.Latitude, *body.Longitude)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	s.computeFields(todos...)
+	if err := json.NewEncoder(w).Encode(todos); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// HandleClearLocation removes a todo's location. Updates can't do it, since an update that
+// leaves all of the location fields out keeps the location as it is.
+func (s *server) HandleClearLocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	todo, err := s.db.ClearTodoLocation(id)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if todo == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	s.computeFields(todo)
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// maintenancePath is where admins turn maintenance mode on and off.
+	maintenancePath = "/api/admin/maintenance"
+	// defaultMaintenanceRetryAfter is how many seconds clients are told to wait before
+	// retrying a write refused during maintenance, if the admin didn't say.
+	defaultMaintenanceRetryAfter = 60
+)
+
+// maintenance describes the server's maintenance mode. It is also the response body of the
+// maintenance endpoints, and the request body for turning maintenance mode on.
+type maintenance struct {
+	// Banner is the message for clients to show while maintenance is going on.
+	Banner string `json:"banner"`
+	// RetryAfter is how many seconds clients should wait before retrying a refused write.
+	RetryAfter int       `json:"retry_after"`
+	Since      time.Time `json:"since"`
+}
+
+// maintenanceStatus is the response body of the maintenance endpoints.
+type maintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+	*maintenance
+}
+
+func (s *server) HandleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	m := s.maintenance.Load()
+	if err := json.NewEncoder(w).Encode(maintenanceStatus{Enabled: m != nil, maintenance: m}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleStartMaintenance(w http.ResponseWriter, r *http.Request) {
+	// The body is optional; without one clients get a generic message from the error
+	// catalog and the default wait.
+	var body maintenance
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	if body.RetryAfter <= 0 {
+		body.RetryAfter = defaultMaintenanceRetryAfter
+	}
+	body.Since = s.clock.Now()
+
+	s.maintenance.Store(&body)
+	// Like log level changes, this is logged at warn so it shows up whatever the level.
+	slog.Warn("maintenance mode started", "banner", body.Banner)
+
+	s.HandleGetMaintenance(w, r)
+}
+
+func (s *server) HandleStopMaintenance(w http.ResponseWriter, r *http.Request) {
+	if s.maintenance.Swap(nil) != nil {
+		slog.Warn("maintenance mode stopped")
+	}
+
+	s.HandleGetMaintenance(w, r)
+}
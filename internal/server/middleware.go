@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ls-todo/internal/version"
+)
+
+// securityHeaders is a middleware that adds headers telling browsers to enable their
+// protections against common attacks (MIME sniffing, clickjacking, leaking URLs through the
+// Referer header, and loading unexpected content).
+//
+// A middleware is just a function that takes a handler and returns a new handler wrapping it.
+// This lets us run code before (or after) every request without repeating it in each handler.
+func (s *server) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		if s.cfg.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", s.cfg.ContentSecurityPolicy)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recoverPanics is a middleware that catches any panic in the handlers it wraps, reports it and
+// responds with an ISE. Without it, net/http would log the panic and close the connection,
+// leaving the client without a response.
+func (s *server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Deferred functions still run while a goroutine is panicking, and `recover` stops
+		// the panic and gives us the value that was passed to `panic`.
+		defer func() {
+			if v := recover(); v != nil {
+				s.reporter.Report(fmt.Errorf("panic: %v", v), r)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// versionHeader is a middleware that adds the server's version to every response, so it's easy
+// to tell which build handled a request.
+func versionHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-App-Version", version.Version)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// regionHeader is a middleware that adds the instance's region to every response, so that in a
+// multi-region deployment clients (and whoever is debugging them) can tell which region
+// handled a request.
+func (s *server) regionHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Region", s.cfg.Region)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readOnlyMethods are the methods that don't change anything, which are still served while the
+// server is read-only.
+var readOnlyMethods = map[string]bool{"GET": true, "HEAD": true, "OPTIONS": true}
+
+// rejectWrites is a middleware that turns away requests that would change something while the
+// server is read-only or in maintenance mode. It answers with a 503 and a Retry-After header,
+// since the server will take writes again once whatever made it read-only has been dealt with.
+//
+// In maintenance mode every response also carries the banner in the X-Maintenance-Banner
+// header, so UIs can show it even on pages that only read. The admin maintenance endpoint is
+// exempt, otherwise maintenance mode could never be turned off.
+func (s *server) rejectWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m := s.maintenance.Load(); m != nil {
+			w.Header().Set("X-Maintenance-Banner", m.Banner)
+			if !readOnlyMethods[r.Method] && r.URL.Path != maintenancePath {
+				w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfter))
+				writeError(w, r, http.StatusServiceUnavailable, "maintenance", m.Banner)
+				return
+			}
+		}
+		if s.readOnly.Load() && !readOnlyMethods[r.Method] {
+			w.Header().Set("Retry-After", "60")
+			writeError(w, r, http.StatusServiceUnavailable, "read_only", "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitConcurrency is a middleware that sheds load once MaxInFlightRequests requests are being
+// handled, responding with a 503 straight away instead of making the request wait. Health
+// checks are never shed, otherwise a busy instance would look dead to the load balancer and be
+// taken out of rotation, moving its load onto the others.
+func (s *server) limitConcurrency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// A `select` with a `default` case doesn't block: if there is no free slot we go
+		// straight to the default case.
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, http.StatusServiceUnavailable, "overloaded", "")
+		}
+	})
+}
+
+// injectFaults is a middleware that delays requests and makes some of them fail, according to
+// the chaos settings. Health checks are left alone so that the load balancer keeps the
+// instance in rotation while we watch how clients deal with the failures.
+func (s *server) injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// A client that gives up shouldn't keep a goroutine waiting out the delay.
+		select {
+		case <-time.After(s.cfg.ChaosLatency):
+		case <-r.Context().Done():
+			return
+		}
+		if rand.Float64() < s.cfg.ChaosErrorRate {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ls-todo/internal/config"
+)
+
+func TestSecurityHeadersOnEveryResponse(t *testing.T) {
+	s := newTestServer(t, &fakeDB{todos: testTodos()}, func(cfg *config.Config) {
+		cfg.SecurityHeaders = true
+		cfg.ContentSecurityPolicy = "default-src 'none'"
+	})
+
+	tests := []struct {
+		method, target string
+		status         int
+	}{
+		{"GET", "/api/todos/1", http.StatusOK},
+		{"GET", "/api/nothing", http.StatusNotFound},
+		{"PATCH", "/api/todos", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		w := serve(s, test.method, test.target, "")
+		if w.Code != test.status {
+			t.Errorf("%s %s: status = %d, want %d", test.method, test.target, w.Code, test.status)
+		}
+		for _, header := range []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy", "Content-Security-Policy"} {
+			if w.Header().Get(header) == "" {
+				t.Errorf("%s %s: no %s header", test.method, test.target, header)
+			}
+		}
+	}
+}
+
+func TestInjectFaultsStopsWaitingWhenTheClientGoesAway(t *testing.T) {
+	s := &server{cfg: &config.Config{ChaosLatency: time.Hour}}
+	called := false
+	handler := s.injectFaults(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/todos", nil).WithContext(ctx))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the handler kept waiting after the request was canceled")
+	}
+	if called {
+		t.Error("the request was handled after it was canceled")
+	}
+}
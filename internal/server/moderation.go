@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"ls-todo/internal/models"
+	"ls-todo/internal/moderation"
+)
+
+// unavailableReason is the flag reason given to todos saved while the content filter was
+// failing.
+const unavailableReason = "content filter unavailable"
+
+// checkContent runs a todo sent by a client through the content filter before it is saved.
+// A flagged todo gets its FlagReason set so that it is saved flagged. If the todo is rejected,
+// checkContent writes the error response and returns false.
+//
+// If the filter itself fails we neither reject the todo, which would stop everyone from
+// saving anything while a moderation service is down, nor let it through unchecked: we save it
+// flagged and report the failure.
+func (s *server) checkContent(w http.ResponseWriter, r *http.Request, todo *models.Todo) bool {
+	// Only the filter decides whether a todo is flagged, whatever the client sent.
+	todo.FlagReason = nil
+	// The filter has to see the todo as it will be stored. Otherwise text the filter would
+	// match could get past it by hiding control characters or extra whitespace that
+	// normalizing removes afterwards. Normalizing twice is harmless, so the database can
+	// still do it for every other way a todo is saved.
+	todo.Normalize()
+
+	verdict, err := s.filter.Check(r.Context(), todo)
+	if err != nil {
+		s.reporter.Report(fmt.Errorf("checking content: %w", err), r)
+		verdict = moderation.Verdict{Action: moderation.Flag, Reason: unavailableReason}
+	}
+
+	switch verdict.Action {
+	case moderation.Reject:
+		writeError(w, r, http.StatusUnprocessableEntity, "content_rejected", verdict.Reason)
+		return false
+	case moderation.Flag:
+		reason := verdict.Reason
+		todo.FlagReason = &reason
+	}
+	return true
+}
+
+func (s *server) HandleClearFlag(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	todo, err := s.db.ClearTodoFlag(id)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if todo == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	s.computeFields(todo)
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
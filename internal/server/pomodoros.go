@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultFocusDays is how many days of focus time are returned when the client doesn't
+	// ask for a specific number.
+	defaultFocusDays = 7
+	// maxFocusDays is the most days of focus time a single request can return.
+	maxFocusDays = 366
+)
+
+func (s *server) HandleGetPomodoros(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	pomodoros, err := s.db.GetPomodoros(id)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if pomodoros == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(pomodoros); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleStartPomodoro(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	// A pomodoro already running on the todo comes back as a conflict, which `writeDBError`
+	// turns into a 409.
+	pomodoro, err := s.db.StartPomodoro(id)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if pomodoro == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(pomodoro); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleCompletePomodoro(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+	pomodoroID, err := strconv.ParseInt(vars["pomodoro_id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	pomodoro, err := s.db.CompletePomodoro(id, pomodoroID)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if pomodoro == nil {
+		writeError(w, r, http.StatusNotFound, "pomodoro_not_found", "")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(pomodoro); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleGetFocus(w http.ResponseWriter, r *http.Request) {
+	days := defaultFocusDays
+	if d := r.URL.Query().Get("days"); d != "" {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 1 || n > maxFocusDays {
+			writeError(w, r, http.StatusBadRequest, "invalid_days", strconv.Itoa(maxFocusDays))
+			return
+		}
+		days = n
+	}
+
+	focusDays, err := s.db.GetFocusDays(days, s.loc)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(focusDays); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter limits how many requests each client IP can make in a window of time. It uses a
+// fixed window: the counts are all reset when the window ends. This is less smooth than a
+// sliding window, but it needs no more than a counter per IP and is easy to reason about.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+// newRateLimiter returns a rateLimiter allowing limit requests per IP in each window.
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, start: time.Now(), counts: map[string]int{}}
+}
+
+// allow counts a request from the given IP and returns whether it is within the limit. If it
+// isn't, it also returns how long until the window ends.
+func (l *rateLimiter) allow(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.start) >= l.window {
+		// Replacing the map rather than zeroing the counts also forgets IPs we haven't seen
+		// in a while, so it can't grow forever.
+		l.start = now
+		l.counts = map[string]int{}
+	}
+	if l.counts[ip] >= l.limit {
+		return false, l.start.Add(l.window).Sub(now)
+	}
+	l.counts[ip]++
+	return true, 0
+}
+
+// throttle wraps a handler so that requests over the limiter's limit get a 429. The client IP
+// is taken from the connection, so behind a proxy every request looks like it comes from the
+// proxy; deployments like that should rate limit at the proxy instead.
+func throttle(l *rateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if ok, wait := l.allow(ip); !ok {
+			// Retry-After is in whole seconds, so we round up to avoid telling the client to
+			// come back before the window has ended.
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			writeError(w, r, http.StatusTooManyRequests, "rate_limited", "")
+			return
+		}
+		next(w, r)
+	}
+}
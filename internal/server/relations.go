@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"ls-todo/internal/models"
+)
+
+func (s *server) HandleGetRelations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	relations, err := s.db.GetRelations(id)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if relations == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(relations); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleCreateRelation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	var relation models.Relation
+	if err := json.NewDecoder(r.Body).Decode(&relation); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+
+	// The database rejects unknown kinds, links to missing todos and duplicate links, which
+	// writeDBError turns into a 422 or 409.
+	created, err := s.db.CreateRelation(id, &relation)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if created == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(created); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleDeleteRelation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+	relationID, err := strconv.ParseInt(vars["relation_id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	relation, err := s.db.DeleteRelation(id, relationID)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if relation == nil {
+		writeError(w, r, http.StatusNotFound, "relation_not_found", "")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(relation); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
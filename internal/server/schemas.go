@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"ls-todo/internal/schemas"
+)
+
+func (s *server) HandleGetSchemas(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(schemas.Names()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleGetSchema(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	schema, ok := schemas.Get(vars["name"])
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "schema_not_found", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	if _, err := w.Write(schema); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"ls-todo/internal/schemas"
+)
+
+// schemaBase is where the schemas are loaded from in tests. Their ids and references are
+// paths, which resolve against it to the URLs they're added under.
+const schemaBase = "https://ls-todo.test/api/schemas/"
+
+// compileSchemas compiles every embedded schema, checking on the way that each is a valid
+// schema and that all of their references resolve.
+func compileSchemas(t *testing.T) map[string]*jsonschema.Schema {
+	t.Helper()
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	for _, name := range schemas.Names() {
+		data, _ := schemas.Get(name)
+		if err := compiler.AddResource(schemaBase+name, bytes.NewReader(data)); err != nil {
+			t.Fatalf("adding schema %s: %v", name, err)
+		}
+	}
+	compiled := map[string]*jsonschema.Schema{}
+	for _, name := range schemas.Names() {
+		schema, err := compiler.Compile(schemaBase + name)
+		if err != nil {
+			t.Fatalf("compiling schema %s: %v", name, err)
+		}
+		compiled[name] = schema
+	}
+	return compiled
+}
+
+// TestResponsesMatchSchemas checks real handler responses against the published schemas, so
+// the schemas can't drift from what the API actually sends.
+func TestResponsesMatchSchemas(t *testing.T) {
+	compiled := compileSchemas(t)
+	s := newTestServer(t, &fakeDB{todos: testTodos()})
+
+	tests := []struct {
+		method, target, body string
+		status               int
+		// schema is the schema the body has to match, and list whether the body is an
+		// array of them.
+		schema string
+		list   bool
+	}{
+		{"GET", "/api/todos", "", http.StatusOK, "todo.json", true},
+		{"GET", "/api/todos?expand=metadata,relations", "", http.StatusOK, "todo.json", true},
+		{"GET", "/api/todos?view=summary", "", http.StatusOK, "todo_summary.json", true},
+		{"GET", "/api/todos/starred", "", http.StatusOK, "todo.json", true},
+		{"GET", "/api/todos/1", "", http.StatusOK, "todo.json", false},
+		{"GET", "/api/todos/2", "", http.StatusOK, "todo.json", false},
+		{"GET", "/api/todos/99", "", http.StatusNotFound, "error.json", false},
+		{"GET", "/api/todos/abc", "", http.StatusBadRequest, "error.json", false},
+		{"GET", "/api/todos/1/relations", "", http.StatusOK, "relation.json", true},
+		{"GET", "/api/todos/99/relations", "", http.StatusNotFound, "error.json", false},
+		{"POST", "/api/todos/1/relations", `{"kind":"related","todo_id":2}`, http.StatusCreated, "relation.json", false},
+		{"POST", "/api/todos/99/relations", `{"kind":"related","todo_id":2}`, http.StatusNotFound, "error.json", false},
+		{"GET", "/api/todos/1/share", "", http.StatusOK, "share.json", true},
+		{"GET", "/api/todos/99/share", "", http.StatusNotFound, "error.json", false},
+		{"GET", "/api/todos/1/pomodoros", "", http.StatusOK, "pomodoro.json", true},
+		{"GET", "/api/todos/99/pomodoros", "", http.StatusNotFound, "error.json", false},
+		{"GET", "/api/todos?sort=nope", "", http.StatusBadRequest, "error.json", false},
+		{"HEAD", "/api/todos?completed=maybe", "", http.StatusBadRequest, "error.json", false},
+		{"POST", "/api/todos", "{", http.StatusBadRequest, "error.json", false},
+	}
+	for _, test := range tests {
+		w := serve(s, test.method, test.target, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s %s: status %d, want %d: %s", test.method, test.target, w.Code, test.status, w.Body)
+			continue
+		}
+
+		var body interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s: decoding response: %v", test.method, test.target, err)
+			continue
+		}
+		values := []interface{}{body}
+		if test.list {
+			items, ok := body.([]interface{})
+			if !ok || len(items) == 0 {
+				t.Errorf("%s %s: want a non-empty array, got %s", test.method, test.target, w.Body)
+				continue
+			}
+			values = items
+		}
+		for _, value := range values {
+			if err := compiled[test.schema].Validate(value); err != nil {
+				t.Errorf("%s %s: response doesn't match %s: %v", test.method, test.target, test.schema, err)
+			}
+		}
+	}
+}
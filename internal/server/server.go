@@ -2,21 +2,39 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
 
+	"ls-todo/internal/cache"
+	"ls-todo/internal/clock"
+	"ls-todo/internal/config"
 	"ls-todo/internal/db"
 	"ls-todo/internal/models"
+	"ls-todo/internal/moderation"
+	"ls-todo/internal/reporting"
+	"ls-todo/internal/version"
 )
 
 // Server is the HTTP main that handles requests.
 type Server interface {
 	http.Handler
 
-	// HandleGetTodos retrieves all todos.
+	// SetReadOnly makes the server refuse requests that would change anything, or accept
+	// them again.
+	SetReadOnly(readOnly bool)
+
+	// HandleGetTodos retrieves a page of todos.
 	HandleGetTodos(w http.ResponseWriter, r *http.Request)
+	// HandleCountTodos counts the todos.
+	HandleCountTodos(w http.ResponseWriter, r *http.Request)
+	// HandleHeadTodos reports the number of todos in the X-Total-Count header.
+	HandleHeadTodos(w http.ResponseWriter, r *http.Request)
 	// HandleGetTodo retrieves a single todo.
 	HandleGetTodo(w http.ResponseWriter, r *http.Request)
 	// HandleCreateTodo creates a new todo.
@@ -27,6 +45,116 @@ type Server interface {
 	HandleDeleteTodo(w http.ResponseWriter, r *http.Request)
 	// HandleToggleTodo toggles a todo's completed status.
 	HandleToggleTodo(w http.ResponseWriter, r *http.Request)
+	// HandleToggleStarred toggles a todo's starred status.
+	HandleToggleStarred(w http.ResponseWriter, r *http.Request)
+	// HandleGetStarredTodos retrieves a page of starred todos.
+	HandleGetStarredTodos(w http.ResponseWriter, r *http.Request)
+	// HandlePatchMetadata updates a todo's metadata with a JSON Merge Patch.
+	HandlePatchMetadata(w http.ResponseWriter, r *http.Request)
+	// HandleGetRelations retrieves a todo's relations to other todos.
+	HandleGetRelations(w http.ResponseWriter, r *http.Request)
+	// HandleCreateRelation links a todo to another.
+	HandleCreateRelation(w http.ResponseWriter, r *http.Request)
+	// HandleDeleteRelation removes a link between two todos.
+	HandleDeleteRelation(w http.ResponseWriter, r *http.Request)
+	// HandleGetShares retrieves a todo's public shares.
+	HandleGetShares(w http.ResponseWriter, r *http.Request)
+	// HandleCreateShare creates a public, expiring link to a todo.
+	HandleCreateShare(w http.ResponseWriter, r *http.Request)
+	// HandleRevokeShare revokes a public link to a todo.
+	HandleRevokeShare(w http.ResponseWriter, r *http.Request)
+	// HandleViewShare shows a shared todo to anyone with the link.
+	HandleViewShare(w http.ResponseWriter, r *http.Request)
+	// HandleGetListViews retrieves the list views a client saved.
+	HandleGetListViews(w http.ResponseWriter, r *http.Request)
+	// HandlePutListView creates or replaces a list view of a client.
+	HandlePutListView(w http.ResponseWriter, r *http.Request)
+	// HandleDeleteListView deletes a list view of a client.
+	HandleDeleteListView(w http.ResponseWriter, r *http.Request)
+	// HandleReportLocation retrieves the open todos near a client's location.
+	HandleReportLocation(w http.ResponseWriter, r *http.Request)
+	// HandleClearLocation removes a todo's location.
+	HandleClearLocation(w http.ResponseWriter, r *http.Request)
+	// HandleSnoozeTodo moves a todo's due date to later.
+	HandleSnoozeTodo(w http.ResponseWriter, r *http.Request)
+	// HandleRescheduleTodos shifts the due dates of several todos at once.
+	HandleRescheduleTodos(w http.ResponseWriter, r *http.Request)
+	// HandleGetPomodoros retrieves the pomodoros of a todo.
+	HandleGetPomodoros(w http.ResponseWriter, r *http.Request)
+	// HandleStartPomodoro starts a pomodoro on a todo.
+	HandleStartPomodoro(w http.ResponseWriter, r *http.Request)
+	// HandleCompletePomodoro completes a running pomodoro.
+	HandleCompletePomodoro(w http.ResponseWriter, r *http.Request)
+	// HandleGetFocus retrieves the focus time of each of the last few days.
+	HandleGetFocus(w http.ResponseWriter, r *http.Request)
+	// HandleInboundEmail creates a todo from an email posted by a mail provider.
+	HandleInboundEmail(w http.ResponseWriter, r *http.Request)
+	// HandleNewTodosTrigger lists the newest todos for automation platforms to poll.
+	HandleNewTodosTrigger(w http.ResponseWriter, r *http.Request)
+	// HandleCompletedTodosTrigger lists the most recently completed todos for automation
+	// platforms to poll.
+	HandleCompletedTodosTrigger(w http.ResponseWriter, r *http.Request)
+	// HandleCreateTodoAction creates a todo for an automation platform.
+	HandleCreateTodoAction(w http.ResponseWriter, r *http.Request)
+	// HandleCompleteTodoAction completes a todo for an automation platform.
+	HandleCompleteTodoAction(w http.ResponseWriter, r *http.Request)
+	// HandleGetSchemas lists the JSON Schemas of the API's bodies.
+	HandleGetSchemas(w http.ResponseWriter, r *http.Request)
+	// HandleGetSchema retrieves a single JSON Schema.
+	HandleGetSchema(w http.ResponseWriter, r *http.Request)
+	// HandleGetVersion retrieves the build information of the running server.
+	HandleGetVersion(w http.ResponseWriter, r *http.Request)
+	// HandleHealth reports that the server is up.
+	HandleHealth(w http.ResponseWriter, r *http.Request)
+	// HandlePing answers as quickly as possible, so clients can measure their latency to
+	// each region.
+	HandlePing(w http.ResponseWriter, r *http.Request)
+	// HandleLoadFixtures loads test data. It is only available in test environments.
+	HandleLoadFixtures(w http.ResponseWriter, r *http.Request)
+	// HandleResetFixtures deletes all data. It is only available in test environments.
+	HandleResetFixtures(w http.ResponseWriter, r *http.Request)
+	// HandleGetClock retrieves the server's current time. It is only available in test
+	// environments.
+	HandleGetClock(w http.ResponseWriter, r *http.Request)
+	// HandleSetClock freezes or moves the server's clock. It is only available in test
+	// environments.
+	HandleSetClock(w http.ResponseWriter, r *http.Request)
+	// HandleResetClock sets the server's clock back to the real time. It is only available in
+	// test environments.
+	HandleResetClock(w http.ResponseWriter, r *http.Request)
+
+	// HandleGetReports lists the reports available to admins.
+	HandleGetReports(w http.ResponseWriter, r *http.Request)
+	// HandleRunReport runs a single admin report.
+	HandleRunReport(w http.ResponseWriter, r *http.Request)
+	// HandleRetentionPreview lists the todos the next retention purge would delete.
+	HandleRetentionPreview(w http.ResponseWriter, r *http.Request)
+	// HandleGetStats retrieves statistics about the system.
+	HandleGetStats(w http.ResponseWriter, r *http.Request)
+	// HandleGetDiagnostics retrieves statistics about the database.
+	HandleGetDiagnostics(w http.ResponseWriter, r *http.Request)
+	// HandleGetJobs retrieves the history of the background jobs.
+	HandleGetJobs(w http.ResponseWriter, r *http.Request)
+	// HandleGetJobLeaders retrieves which instance runs each background job.
+	HandleGetJobLeaders(w http.ResponseWriter, r *http.Request)
+	// HandleClearFlag clears the content filter's flag on a todo once it has been reviewed.
+	HandleClearFlag(w http.ResponseWriter, r *http.Request)
+	// HandleGetCustomFields retrieves the custom field definitions.
+	HandleGetCustomFields(w http.ResponseWriter, r *http.Request)
+	// HandlePutCustomField creates or replaces a custom field definition.
+	HandlePutCustomField(w http.ResponseWriter, r *http.Request)
+	// HandleDeleteCustomField deletes a custom field definition.
+	HandleDeleteCustomField(w http.ResponseWriter, r *http.Request)
+	// HandleGetMaintenance retrieves whether the server is in maintenance mode.
+	HandleGetMaintenance(w http.ResponseWriter, r *http.Request)
+	// HandleStartMaintenance puts the server in maintenance mode.
+	HandleStartMaintenance(w http.ResponseWriter, r *http.Request)
+	// HandleStopMaintenance takes the server out of maintenance mode.
+	HandleStopMaintenance(w http.ResponseWriter, r *http.Request)
+	// HandleGetLogLevel retrieves the current log level.
+	HandleGetLogLevel(w http.ResponseWriter, r *http.Request)
+	// HandleSetLogLevel changes the log level.
+	HandleSetLogLevel(w http.ResponseWriter, r *http.Request)
 }
 
 // server implements Server for "production". In other words, this is the live server used
@@ -34,56 +162,273 @@ type Server interface {
 type server struct {
 	http.Handler
 
-	db db.PGManager
+	db       db.PGManager
+	reports  db.Reporter
+	reporter reporting.Reporter
+	// filter checks the content of todos before they are saved.
+	filter moderation.Filter
+	cfg    *config.Config
+	// clock is where we get the current time from, so that tests can control it.
+	clock clock.Clock
+
+	// loc is the time zone dates are worked out in.
+	loc *time.Location
+
+	// statsCache caches the responses of the expensive stats and report endpoints.
+	statsCache *cache.Cache
+
+	// started is when the server was created, used to report its uptime.
+	started time.Time
+
+	// readOnly is set when the server must not change anything, e.g. because the database
+	// schema is older than the code. It is atomic since every request reads it.
+	readOnly atomic.Bool
+	// nonces are the nonces of the signed requests we've accepted recently.
+	nonces *nonceCache
+	// slots holds a value for each request being handled when MaxInFlightRequests is set
+	// (see limitConcurrency). It has to live here rather than in the middleware: mux wraps
+	// each request's handler in its middlewares again, so anything a middleware makes when it
+	// is called is made again for every request.
+	slots chan struct{}
+
+	// maintenance is set while the server is in maintenance mode, and nil otherwise.
+	maintenance atomic.Pointer[maintenance]
 }
 
 // New returns a new Server instance. Notice how we return the interface and not the struct.
 // Likewise, we use the PGManager interface instead of a pgManager struct. This allows us to
 // pass in a mock database that implements the PGManager interface for when we want to do
 // unit tests.
-func New(router *mux.Router, db db.PGManager) Server {
+func New(
+	router *mux.Router,
+	db db.PGManager,
+	reports db.Reporter,
+	reporter reporting.Reporter,
+	filter moderation.Filter,
+	cfg *config.Config,
+	clk clock.Clock,
+) Server {
 	// This creates a new *server struct instance. Notice the pointer (&): this means when
 	// the server is returned it will be the same place in memory when used elsewhere (i.e.
 	// the struct isn't copied).
 	server := &server{
-		Handler: router,
-		db:      db,
+		Handler:  router,
+		db:       db,
+		reports:  reports,
+		reporter: reporter,
+		filter:   filter,
+		cfg:      cfg,
+		clock:    clk,
+		started:  time.Now(),
+
+		loc:        cfg.Location(),
+		statsCache: cache.New(cfg.StatsCacheTTL),
+		// A nonce only needs remembering while its timestamp could be accepted, which is
+		// up to the tolerance either side of now.
+		nonces: newNonceCache(2 * cfg.SignatureTolerance),
+	}
+	if cfg.MaxInFlightRequests > 0 {
+		// A buffered channel makes a simple semaphore: sending takes a slot and receiving
+		// gives it back. Once the buffer is full, nothing else can be sent until a slot is
+		// freed.
+		server.slots = make(chan struct{}, cfg.MaxInFlightRequests)
+	}
+	if cfg.MaintenanceBanner != "" {
+		server.maintenance.Store(&maintenance{
+			Banner:     cfg.MaintenanceBanner,
+			RetryAfter: defaultMaintenanceRetryAfter,
+			Since:      server.started,
+		})
 	}
 	// We set up our routes as part of the constructor function.
 	server.routes(router)
+	if cfg.SecurityHeaders {
+		// Middlewares added with `Use` only run once a route has matched, so 404 and 405
+		// responses would go out without the headers. Wrapping the whole router covers them.
+		server.Handler = server.securityHeaders(router)
+	}
 	return server
 }
 
+// healthPath is the path load balancers use to check the server is up.
+const healthPath = "/api/health"
+
 // routes attaches all of the handler functions for the api paths that we need to handle.
 func (s *server) routes(router *mux.Router) {
+	// Middlewares added with `Use` run for every route on the router, in the order they
+	// were added. We recover from panics first so that a panic in any of the others is
+	// caught too.
+	router.Use(s.recoverPanics)
+	router.Use(versionHeader)
+	router.Use(s.rejectWrites)
+	if s.cfg.Region != "" {
+		router.Use(s.regionHeader)
+	}
+	if s.cfg.MaxInFlightRequests > 0 {
+		router.Use(s.limitConcurrency)
+	}
+	if s.cfg.ChaosLatency > 0 || s.cfg.ChaosErrorRate > 0 {
+		router.Use(s.injectFaults)
+	}
+
+	// Creating todos and share links is limited per client IP when the deployment asks for
+	// it, so one client can't fill the database (or mint share links for spam). Both share
+	// the same limiter so the limit can't be doubled by spreading requests across them.
+	createTodo, createShare := s.HandleCreateTodo, s.HandleCreateShare
+	if s.cfg.CreateRateLimit > 0 {
+		limiter := newRateLimiter(s.cfg.CreateRateLimit, time.Hour)
+		createTodo, createShare = throttle(limiter, createTodo), throttle(limiter, createShare)
+	}
+
 	router.HandleFunc("/api/todos", s.HandleGetTodos).Methods("GET")
+	router.HandleFunc("/api/todos", s.HandleHeadTodos).Methods("HEAD")
+	// Routes are matched in the order they are added, so this has to come before
+	// `/api/todos/{id}` or "count" would be treated as an id.
+	router.HandleFunc("/api/todos/count", s.HandleCountTodos).Methods("GET")
+	router.HandleFunc("/api/todos/starred", s.HandleGetStarredTodos).Methods("GET")
+	router.HandleFunc("/api/todos/reschedule", s.HandleRescheduleTodos).Methods("POST")
 	router.HandleFunc("/api/todos/{id}", s.HandleGetTodo).Methods("GET")
-	router.HandleFunc("/api/todos", s.HandleCreateTodo).Methods("POST")
+	router.HandleFunc("/api/todos", createTodo).Methods("POST")
 	router.HandleFunc("/api/todos/{id}", s.HandleUpdateTodo).Methods("PUT")
 	router.HandleFunc("/api/todos/{id}", s.HandleDeleteTodo).Methods("DELETE")
 	router.HandleFunc("/api/todos/{id}/toggle_completed", s.HandleToggleTodo).Methods("POST")
+	router.HandleFunc("/api/todos/{id}/toggle_starred", s.HandleToggleStarred).Methods("POST")
+	router.HandleFunc("/api/todos/{id}/metadata", s.HandlePatchMetadata).Methods("PATCH")
+	router.HandleFunc("/api/todos/{id}/relations", s.HandleGetRelations).Methods("GET")
+	router.HandleFunc("/api/todos/{id}/relations", s.HandleCreateRelation).Methods("POST")
+	router.HandleFunc("/api/todos/{id}/relations/{relation_id}", s.HandleDeleteRelation).Methods("DELETE")
+	router.HandleFunc("/api/todos/{id}/share", s.HandleGetShares).Methods("GET")
+	router.HandleFunc("/api/todos/{id}/share", createShare).Methods("POST")
+	router.HandleFunc("/api/todos/{id}/share/{share_id}", s.HandleRevokeShare).Methods("DELETE")
+	router.HandleFunc("/api/todos/{id}/location", s.HandleClearLocation).Methods("DELETE")
+	router.HandleFunc("/api/todos/{id}/snooze", s.HandleSnoozeTodo).Methods("POST")
+	router.HandleFunc("/api/todos/{id}/pomodoros", s.HandleGetPomodoros).Methods("GET")
+	router.HandleFunc("/api/todos/{id}/pomodoros", s.HandleStartPomodoro).Methods("POST")
+	router.HandleFunc("/api/todos/{id}/pomodoros/{pomodoro_id}/complete", s.HandleCompletePomodoro).Methods("POST")
+	router.HandleFunc("/api/me/views", s.HandleGetListViews).Methods("GET")
+	router.HandleFunc("/api/me/views/{name}", s.HandlePutListView).Methods("PUT")
+	router.HandleFunc("/api/me/views/{name}", s.HandleDeleteListView).Methods("DELETE")
+	router.HandleFunc("/api/focus", s.HandleGetFocus).Methods("GET")
+	router.HandleFunc("/api/location", s.HandleReportLocation).Methods("POST")
+	router.HandleFunc("/api/inbound/email/{token}", s.HandleInboundEmail).Methods("POST")
+	router.HandleFunc("/api/integrations/triggers/new_todo", s.requireAPIKey(s.HandleNewTodosTrigger)).Methods("GET")
+	router.HandleFunc("/api/integrations/triggers/completed_todo", s.requireAPIKey(s.HandleCompletedTodosTrigger)).Methods("GET")
+	router.HandleFunc("/api/integrations/actions/create_todo", s.requireAPIKey(s.requireSignature(s.HandleCreateTodoAction))).Methods("POST")
+	router.HandleFunc("/api/integrations/actions/complete_todo", s.requireAPIKey(s.requireSignature(s.HandleCompleteTodoAction))).Methods("POST")
+	router.HandleFunc("/api/schemas", s.HandleGetSchemas).Methods("GET")
+	router.HandleFunc("/api/schemas/{name}", s.HandleGetSchema).Methods("GET")
+	router.HandleFunc("/api/version", s.HandleGetVersion).Methods("GET")
+	router.HandleFunc(healthPath, s.HandleHealth).Methods("GET")
+	router.HandleFunc("/api/ping", s.HandlePing).Methods("GET")
+
+	// Shared todos can be viewed by anyone, so we limit how often each client can view them
+	// to make guessing tokens (or scraping shared todos) impractical.
+	viewShare := s.HandleViewShare
+	if s.cfg.ShareRateLimit > 0 {
+		viewShare = throttle(newRateLimiter(s.cfg.ShareRateLimit, time.Minute), viewShare)
+	}
+	router.HandleFunc(sharePath+"{token}", viewShare).Methods("GET")
+
+	router.HandleFunc("/api/test/fixtures", s.requireFixtures(s.HandleLoadFixtures)).Methods("POST")
+	router.HandleFunc("/api/test/reset", s.requireFixtures(s.HandleResetFixtures)).Methods("POST")
+	router.HandleFunc("/api/test/clock", s.requireFixtures(s.HandleGetClock)).Methods("GET")
+	router.HandleFunc("/api/test/clock", s.requireFixtures(s.HandleSetClock)).Methods("PUT")
+	router.HandleFunc("/api/test/clock", s.requireFixtures(s.HandleResetClock)).Methods("DELETE")
+
+	router.HandleFunc("/api/admin/reports", s.requireAdmin(s.HandleGetReports)).Methods("GET")
+	router.HandleFunc("/api/admin/reports/{name}", s.requireAdmin(s.HandleRunReport)).Methods("GET")
+	router.HandleFunc("/api/admin/retention/preview", s.requireAdmin(s.HandleRetentionPreview)).Methods("GET")
+	router.HandleFunc("/api/admin/stats", s.requireAdmin(s.HandleGetStats)).Methods("GET")
+	router.HandleFunc("/api/admin/diagnostics", s.requireAdmin(s.HandleGetDiagnostics)).Methods("GET")
+	router.HandleFunc("/api/admin/jobs", s.requireAdmin(s.HandleGetJobs)).Methods("GET")
+	router.HandleFunc("/api/admin/jobs/leaders", s.requireAdmin(s.HandleGetJobLeaders)).Methods("GET")
+	router.HandleFunc("/api/admin/todos/{id}/flag", s.requireAdmin(s.HandleClearFlag)).Methods("DELETE")
+	router.HandleFunc("/api/admin/custom_fields", s.requireAdmin(s.HandleGetCustomFields)).Methods("GET")
+	router.HandleFunc("/api/admin/custom_fields/{name}", s.requireAdmin(s.HandlePutCustomField)).Methods("PUT")
+	router.HandleFunc("/api/admin/custom_fields/{name}", s.requireAdmin(s.HandleDeleteCustomField)).Methods("DELETE")
+	router.HandleFunc(maintenancePath, s.requireAdmin(s.HandleGetMaintenance)).Methods("GET")
+	router.HandleFunc(maintenancePath, s.requireAdmin(s.HandleStartMaintenance)).Methods("PUT")
+	router.HandleFunc(maintenancePath, s.requireAdmin(s.HandleStopMaintenance)).Methods("DELETE")
+	router.HandleFunc("/api/admin/loglevel", s.requireAdmin(s.HandleGetLogLevel)).Methods("GET")
+	router.HandleFunc("/api/admin/loglevel", s.requireAdmin(s.HandleSetLogLevel)).Methods("PUT")
+}
+
+func (s *server) SetReadOnly(readOnly bool) {
+	s.readOnly.Store(readOnly)
 }
 
 func (s *server) HandleGetTodos(w http.ResponseWriter, r *http.Request) {
-	// First, we make our call to the database. If we get an error, we return and ISE
-	// (Internal Server Error -- 500). This is because the only error we should get
-	// is one where the database fails to perform the query. An empty result set is
-	// fine.
-	todos, err := s.db.GetTodos()
+	// First, we read which page of todos the client wants. A saved view fills in whatever
+	// the request leaves out.
+	r, ok := s.applyListView(w, r)
+	if !ok {
+		return
+	}
+	opts, err := parseListOptions(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeParamError(w, r, err)
 		return
 	}
-	// the `json.NewEncoder` needs a data type that satisfies the `io.Writer` interface,
-	// which the `http.ResponseWriter` hapens to do! Thus, to send JSON back in the response
-	// body, we create a new encoder using our response writer, and then encode the todos.
-	if err := json.NewEncoder(w).Encode(todos); err != nil {
-		// We return an ISE here because it means something went wrong with the encoding
-		// process, and is not a user error.
+
+	// Unless the client asked for an order (or is following a cursor, which has one), we
+	// use the configured one. main has already checked that it parses, and an empty one
+	// leaves the database's own order.
+	if opts.Sort == nil {
+		opts.Sort, _ = db.ParseSort(s.cfg.DefaultSort)
+	}
+
+	// Then we make our call to the database. If we get an error, `writeDBError` picks
+	// the right status for it -- usually an ISE (Internal Server Error -- 500), since the
+	// database failing to perform the query isn't the client's fault. An empty result set
+	// is fine.
+	todos, err := s.db.GetTodos(opts)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	s.writeTodos(w, r, todos, opts)
+}
+
+// todoCount is the response body for HandleCountTodos.
+type todoCount struct {
+	Count int64 `json:"count"`
+}
+
+func (s *server) HandleCountTodos(w http.ResponseWriter, r *http.Request) {
+	completed, err := parseCompleted(r)
+	if err != nil {
+		writeParamError(w, r, err)
+		return
+	}
+
+	count, err := s.db.CountTodos(completed)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(todoCount{Count: count}); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+func (s *server) HandleHeadTodos(w http.ResponseWriter, r *http.Request) {
+	completed, err := parseCompleted(r)
+	if err != nil {
+		// net/http drops the body of a HEAD response, but the headers are still sent.
+		writeParamError(w, r, err)
+		return
+	}
+
+	count, err := s.db.CountTodos(completed)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	// A HEAD response never has a body, so the count goes in a header.
+	w.Header().Set("X-Total-Count", strconv.FormatInt(count, 10))
+}
+
 func (s *server) HandleGetTodo(w http.ResponseWriter, r *http.Request) {
 	// `mux.Vars` extracts the identifiers found in the path (in this case the `id` in
 	// `/api/todos/{id}`.
@@ -94,22 +439,35 @@ func (s *server) HandleGetTodo(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		// We send a 400 here because realistically the only reason this would fail is
 		// because the user sent a non-integer value in the slug.
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
 		return
 	}
 
-	todo, err := s.db.GetTodo(id)
+	var todo *models.Todo
+	// With `?as_of=<RFC 3339 timestamp>` we send back the todo as it was at that time instead.
+	// Its relations aren't part of its history, so they are left out.
+	if asOf := r.URL.Query().Get("as_of"); asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_as_of", "")
+			return
+		}
+		todo, err = s.db.GetTodoAsOf(id, t)
+	} else {
+		todo, err = s.db.GetTodo(id)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		s.writeDBError(w, r, err)
 		return
 	}
 	// We have to check for the condition where no todo was found. In that case it should
 	// be nil.
 	if todo == nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
 		return
 	}
 
+	s.computeFields(todo)
 	if err := json.NewEncoder(w).Encode(todo); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -117,21 +475,25 @@ func (s *server) HandleGetTodo(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) HandleCreateTodo(w http.ResponseWriter, r *http.Request) {
 	// First, we decode the JSON into a Todo struct.
-	var todo models.Todo
-	if err := json.NewDecoder(r.Body).Decode(&todo); err != nil {
+	todo, err := s.decodeTodo(w, r)
+	if err != nil {
 		// While it's arguable that we should return an ISE in case some went wrong
 		// with the decoding, the likely reason why that would happen is because of
 		// bad JSON sent in the request body.
-		w.WriteHeader(http.StatusBadRequest)
+		writeParamError(w, r, err)
+		return
+	}
+	if !s.checkContent(w, r, todo) {
 		return
 	}
 
-	todoWithID, err := s.db.CreateTodo(&todo)
+	todoWithID, err := s.db.CreateTodo(todo)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		s.writeDBError(w, r, err)
 		return
 	}
 
+	s.computeFields(todoWithID)
 	if err := json.NewEncoder(w).Encode(todoWithID); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -145,22 +507,26 @@ func (s *server) HandleUpdateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var diff models.Todo
-	if err := json.NewDecoder(r.Body).Decode(&diff); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	diff, err := s.decodeTodo(w, r)
+	if err != nil {
+		writeParamError(w, r, err)
+		return
+	}
+	if !s.checkContent(w, r, diff) {
 		return
 	}
 
-	todo, err := s.db.UpdateTodo(&diff, id)
+	todo, err := s.db.UpdateTodo(diff, id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		s.writeDBError(w, r, err)
 		return
 	}
 	if todo == nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
 		return
 	}
 
+	s.computeFields(todo)
 	if err := json.NewEncoder(w).Encode(todo); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -176,14 +542,15 @@ func (s *server) HandleDeleteTodo(w http.ResponseWriter, r *http.Request) {
 
 	todo, err := s.db.DeleteTodo(id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		s.writeDBError(w, r, err)
 		return
 	}
 	if todo == nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
 		return
 	}
 
+	s.computeFields(todo)
 	if err := json.NewEncoder(w).Encode(todo); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -199,15 +566,309 @@ func (s *server) HandleToggleTodo(w http.ResponseWriter, r *http.Request) {
 
 	todo, err := s.db.ToggleTodo(id)
 	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if todo == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	s.computeFields(todo)
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleToggleStarred(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	todo, err := s.db.ToggleStarred(id)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if todo == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	s.computeFields(todo)
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleGetStarredTodos(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		writeParamError(w, r, err)
+		return
+	}
+
+	todos, err := s.db.GetStarredTodos(opts)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	s.writeTodos(w, r, todos, opts)
+}
+
+func (s *server) HandlePatchMetadata(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	// A merge patch has to be a JSON object; decoding into a map rejects anything else.
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+
+	todo, err := s.db.PatchMetadata(id, patch)
+	if err != nil {
+		s.writeDBError(w, r, err)
 		return
 	}
 	if todo == nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
 		return
 	}
 
+	s.computeFields(todo)
 	if err := json.NewEncoder(w).Encode(todo); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+func (s *server) HandleGetVersion(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(version.Get()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// health is the response body for HandleHealth and HandlePing.
+type health struct {
+	Status string `json:"status"`
+	// Region and Weight let load balancers and clients prefer the nearest instance that
+	// wants traffic. Region is left out when it isn't configured.
+	Region string `json:"region,omitempty"`
+	Weight int    `json:"weight"`
+	// Maintenance is the maintenance banner, for UIs that poll the health endpoint. It is
+	// left out when the server isn't in maintenance mode.
+	Maintenance string `json:"maintenance,omitempty"`
+}
+
+func (s *server) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	body := health{Status: "ok", Region: s.cfg.Region, Weight: s.cfg.RegionWeight}
+	if m := s.maintenance.Load(); m != nil {
+		body.Maintenance = m.Banner
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (s *server) HandlePing(w http.ResponseWriter, r *http.Request) {
+	// A cached answer would measure the latency to the cache, not to us.
+	w.Header().Set("Cache-Control", "no-store")
+	s.HandleHealth(w, r)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////
+//// Helpers /////////////////////////////////////////////////////////////////////////////
+
+// parseCompleted reads the optional `completed` query parameter. It returns nil if the
+// parameter isn't set.
+func parseCompleted(r *http.Request) (*bool, error) {
+	value := r.URL.Query().Get("completed")
+	if value == "" {
+		return nil, nil
+	}
+	completed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, paramError("invalid_completed")
+	}
+	return &completed, nil
+}
+
+// parseListOptions reads the optional `limit` and `offset` query parameters. The database
+// applies the default and maximum page sizes, so we only check they are sensible numbers.
+func parseListOptions(r *http.Request) (db.ListOptions, error) {
+	var opts db.ListOptions
+	query := r.URL.Query()
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return opts, paramError("invalid_limit")
+		}
+		opts.Limit = n
+	}
+	if offset := query.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return opts, paramError("invalid_offset")
+		}
+		opts.Offset = n
+	}
+	// Sorts look like `?sort=-starred,due_date`: a comma separated list of fields, each
+	// prefixed with `-` to sort it in descending order.
+	sort, err := db.ParseSort(query.Get("sort"))
+	if err != nil {
+		return opts, paramError("invalid_sort")
+	}
+	opts.Sort = sort
+	// A cursor (from a Link header) continues a list sorted by a keyset field from where the
+	// last page ended. It carries its own sort, which a `sort` parameter can only repeat.
+	if c := query.Get("cursor"); c != "" {
+		cursor, err := db.ParseCursor(c)
+		if err != nil {
+			return opts, paramError("invalid_cursor")
+		}
+		if opts.Sort != nil && (len(opts.Sort) != 1 || opts.Sort[0] != cursor.Sort) {
+			return opts, paramError("invalid_cursor")
+		}
+		opts.Sort = []db.SortKey{cursor.Sort}
+		opts.Cursor = c
+	}
+	// Custom field filters look like `?cf.sprint=12`. The database checks the fields exist.
+	for key := range query {
+		if name := strings.TrimPrefix(key, "cf."); name != key {
+			if opts.CustomFields == nil {
+				opts.CustomFields = map[string]string{}
+			}
+			opts.CustomFields[name] = query.Get(key)
+		}
+	}
+	// Lists leave out relations unless they're asked for with `?expand=relations`, the same
+	// way they leave out metadata.
+	opts.Relations = parseExpand(r)["relations"]
+	// writeTodos picks the view once the todos are fetched, but we check it here so that a
+	// bad one doesn't cost a query. Saved views have been replaced by their layout by now
+	// (see applyListView), and other lists don't support them.
+	if !builtInView(query.Get("view")) {
+		return opts, paramError("invalid_view")
+	}
+	return opts, nil
+}
+
+// writeTodos sends a page of todos in the view the client asked for with the `view` query
+// parameter. Clients can ask for a summary of each todo instead of the whole thing, which is
+// much smaller when todos have long descriptions.
+func (s *server) writeTodos(w http.ResponseWriter, r *http.Request, todos []*models.Todo, opts db.ListOptions) {
+	s.computeFields(todos...)
+	// Metadata can be large and is only useful to integrations, so we leave it out unless it
+	// was asked for.
+	if !parseExpand(r)["metadata"] {
+		for _, todo := range todos {
+			todo.Metadata = nil
+		}
+	}
+	var body interface{} = todos
+	switch r.URL.Query().Get("view") {
+	case "", "full":
+	case "summary":
+		summaries := make([]*models.TodoSummary, len(todos))
+		for i, todo := range todos {
+			summaries[i] = todo.Summary(s.cfg.SummaryDescriptionLength)
+		}
+		body = summaries
+	default:
+		writeError(w, r, http.StatusBadRequest, "invalid_view", "")
+		return
+	}
+	s.setPageLinks(w, r, opts, todos)
+
+	// the `json.NewEncoder` needs a data type that satisfies the `io.Writer` interface,
+	// which the `http.ResponseWriter` hapens to do! Thus, to send JSON back in the response
+	// body, we create a new encoder using our response writer, and then encode the todos.
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		// We return an ISE here because it means something went wrong with the encoding
+		// process, and is not a user error.
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// setPageLinks adds a Link header (RFC 8288) pointing at the first, previous and next pages of
+// a list, so generic HTTP tooling can page through it without knowing our query parameters.
+//
+// We don't count the todos to find out whether there is a next page; if this page is full we
+// assume there is one. At worst, the client fetches an empty page at the end.
+//
+// When the list is sorted by a keyset field, the next link uses a cursor rather than an offset,
+// since that stays fast however far through the list the client gets. A cursor can only move
+// forwards, so there is no previous link then.
+func (s *server) setPageLinks(w http.ResponseWriter, r *http.Request, opts db.ListOptions, todos []*models.Todo) {
+	// The database applies the same defaults, so this is the size the page was fetched with.
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = s.cfg.DefaultPageSize
+	}
+	if limit > s.cfg.MaxPageSize {
+		limit = s.cfg.MaxPageSize
+	}
+
+	// The links keep every other query parameter (filters, view etc.) so that each page is
+	// of the same list.
+	link := func(offset int, cursor, rel string) string {
+		query := r.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Del("offset")
+		query.Del("cursor")
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		} else if offset > 0 || rel == "first" {
+			query.Set("offset", strconv.Itoa(offset))
+		}
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), rel)
+	}
+
+	links := []string{link(0, "", "first")}
+	if db.IsKeysetSort(opts.Sort) {
+		if len(todos) >= limit {
+			links = append(links, link(0, db.NextCursor(todos[len(todos)-1], opts.Sort[0]), "next"))
+		}
+		w.Header().Set("Link", strings.Join(links, ", "))
+		return
+	}
+	if opts.Offset > 0 {
+		prev := opts.Offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link(prev, "", "prev"))
+	}
+	if len(todos) >= limit {
+		links = append(links, link(opts.Offset+limit, "", "next"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// computeFields fills in the computed fields of the todos before they are sent to the client.
+func (s *server) computeFields(todos ...*models.Todo) {
+	now := s.clock.Now().In(s.loc)
+	for _, todo := range todos {
+		todo.ComputeFields(now)
+	}
+}
+
+// parseExpand reads the `expand` query parameter, a comma separated list of the optional parts
+// of a payload to include (e.g. `?expand=metadata`).
+func parseExpand(r *http.Request) map[string]bool {
+	expand := map[string]bool{}
+	for _, part := range strings.Split(r.URL.Query().Get("expand"), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			expand[part] = true
+		}
+	}
+	return expand
+}
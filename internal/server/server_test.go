@@ -0,0 +1,168 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"ls-todo/internal/clock"
+	"ls-todo/internal/config"
+	"ls-todo/internal/db"
+	"ls-todo/internal/models"
+	"ls-todo/internal/moderation"
+	"ls-todo/internal/reporting"
+)
+
+// fakeDB is a PGManager that serves a fixed set of todos, for testing handlers without a
+// database. Only the methods the tests call are implemented; calling any other panics, since
+// the embedded interface is nil.
+type fakeDB struct {
+	db.PGManager
+	todos []*models.Todo
+	// views are the saved list views, keyed by client id and then name.
+	views map[string]map[string]*models.ListView
+	// lists counts the calls to the list methods, and opts is what the last one was called
+	// with.
+	lists int
+	opts  db.ListOptions
+}
+
+func (f *fakeDB) GetTodos(opts db.ListOptions) ([]*models.Todo, error) {
+	f.lists++
+	f.opts = opts
+	return f.todos, nil
+}
+
+func (f *fakeDB) GetListViews(clientID string) ([]*models.ListView, error) {
+	views := []*models.ListView{}
+	for _, view := range f.views[clientID] {
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+func (f *fakeDB) GetListView(clientID, name string) (*models.ListView, error) {
+	return f.views[clientID][name], nil
+}
+
+func (f *fakeDB) GetStarredTodos(opts db.ListOptions) ([]*models.Todo, error) {
+	f.lists++
+	f.opts = opts
+	return f.todos, nil
+}
+
+func (f *fakeDB) GetTodo(id int64) (*models.Todo, error) {
+	for _, todo := range f.todos {
+		if todo.ID == id {
+			return todo, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeDB) GetRelations(todoID int64) ([]*models.Relation, error) {
+	todo, _ := f.GetTodo(todoID)
+	if todo == nil {
+		return nil, nil
+	}
+	return append([]*models.Relation{}, todo.Relations...), nil
+}
+
+func (f *fakeDB) CreateRelation(todoID int64, relation *models.Relation) (*models.Relation, error) {
+	if todo, _ := f.GetTodo(todoID); todo == nil {
+		return nil, nil
+	}
+	return &models.Relation{ID: 1, Kind: relation.Kind, TodoID: relation.TodoID}, nil
+}
+
+func (f *fakeDB) GetShares(todoID int64) ([]*models.Share, error) {
+	if todo, _ := f.GetTodo(todoID); todo == nil {
+		return nil, nil
+	}
+	return []*models.Share{{ID: 1, TodoID: todoID, Token: "token"}}, nil
+}
+
+func (f *fakeDB) GetPomodoros(todoID int64) ([]*models.Pomodoro, error) {
+	if todo, _ := f.GetTodo(todoID); todo == nil {
+		return nil, nil
+	}
+	completedAt := time.Date(2024, 3, 5, 9, 25, 0, 0, time.UTC)
+	return []*models.Pomodoro{{
+		ID: 1, TodoID: todoID,
+		StartedAt:   time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC),
+		CompletedAt: &completedAt,
+	}}, nil
+}
+
+// testTodos returns todos with every optional field filled in on one of them, so that
+// responses include every field a todo can have.
+func testTodos() []*models.Todo {
+	latitude, longitude, radius := 51.5, -0.12, 200
+	completedAt := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+	return []*models.Todo{
+		{
+			ID: 1, Title: "Buy milk", Day: "05", Month: "03", Year: "2024",
+			Description: "Semi-skimmed", Starred: true,
+			CreatedAt:    time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+			CustomFields: models.JSONObject{"sprint": 12},
+			Metadata:     models.JSONObject{"source": "zapier"},
+			Latitude:     &latitude, Longitude: &longitude, RadiusMeters: &radius,
+			Relations: []*models.Relation{{ID: 3, Kind: models.RelationDuplicateOf, TodoID: 2}},
+		},
+		{
+			ID: 2, Title: "Get milk", Completed: true, CompletedAt: &completedAt,
+			CreatedAt:    time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+			CustomFields: models.JSONObject{},
+		},
+	}
+}
+
+// newTestServer returns a server backed by the given fakeDB. Each option can change the
+// config before the server is created.
+func newTestServer(t *testing.T, database *fakeDB, options ...func(*config.Config)) Server {
+	t.Helper()
+	cfg := &config.Config{
+		Timezone:                 "UTC",
+		DefaultPageSize:          100,
+		MaxPageSize:              1000,
+		SummaryDescriptionLength: 4,
+		StatsCacheTTL:            time.Minute,
+		SignatureTolerance:       5 * time.Minute,
+	}
+	for _, option := range options {
+		option(cfg)
+	}
+	reporter, err := reporting.New("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := moderation.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(mux.NewRouter(), database, nil, reporter, filter, cfg, clock.NewFake())
+}
+
+// serve sends a request to the server and returns the response.
+func serve(s http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestListViewIsCheckedBeforeQuerying(t *testing.T) {
+	database := &fakeDB{todos: testTodos()}
+	s := newTestServer(t, database)
+
+	w := serve(s, "GET", "/api/todos?view=compact", "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if database.lists != 0 {
+		t.Errorf("the todos were fetched %d times for an invalid view", database.lists)
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sharePath is where shared todos are viewed. It is outside of /api since the links are meant
+// to be opened by people as well as programs.
+const sharePath = "/share/"
+
+// shareTemplate is the page shown when a shared todo is opened in a browser. `html/template`
+// escapes everything we put in it, so a todo's title can't inject markup into the page.
+var shareTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Completed}}<p>Completed</p>{{end}}
+{{with .Year}}<p>Due {{$.Year}}-{{$.Month}}-{{$.Day}}</p>{{end}}
+<p>{{.Description}}</p>
+</body>
+</html>
+`))
+
+// createShare is the request body for HandleCreateShare.
+type createShare struct {
+	// ExpiresIn is how long the share should last, as a Go duration (e.g. "24h").
+	ExpiresIn string `json:"expires_in"`
+}
+
+func (s *server) HandleGetShares(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	shares, err := s.db.GetShares(id)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if shares == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	for _, share := range shares {
+		share.URL = sharePath + share.Token
+	}
+	if err := json.NewEncoder(w).Encode(shares); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleCreateShare(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	// The body is optional; without one the share lasts as long as the config allows.
+	var body createShare
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	ttl := s.cfg.ShareLinkTTL
+	if body.ExpiresIn != "" {
+		d, err := time.ParseDuration(body.ExpiresIn)
+		if err != nil || d <= 0 || d > ttl {
+			writeError(w, r, http.StatusBadRequest, "invalid_expires_in", ttl.String())
+			return
+		}
+		ttl = d
+	}
+
+	share, err := s.db.CreateShare(id, s.clock.Now().Add(ttl))
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if share == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	share.URL = sharePath + share.Token
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(share); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleRevokeShare(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+	shareID, err := strconv.ParseInt(vars["share_id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	share, err := s.db.RevokeShare(id, shareID)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if share == nil {
+		writeError(w, r, http.StatusNotFound, "share_not_found", "")
+		return
+	}
+
+	share.URL = sharePath + share.Token
+	if err := json.NewEncoder(w).Encode(share); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleViewShare(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	todo, err := s.db.ViewShare(vars["token"])
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	// We don't say whether the share never existed, expired or was revoked; the person
+	// holding the link can't do anything about it either way.
+	if todo == nil {
+		writeError(w, r, http.StatusNotFound, "share_not_found", "")
+		return
+	}
+
+	// The share is public, so we only send what is needed to view the todo: integrations'
+	// metadata, links to todos that haven't been shared and where the todo is stay private.
+	todo.Metadata = nil
+	todo.Latitude, todo.Longitude, todo.RadiusMeters = nil, nil, nil
+	s.computeFields(todo)
+
+	// Browsers ask for HTML, so they get a page; everything else gets JSON.
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := shareTemplate.Execute(w, todo); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
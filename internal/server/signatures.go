@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxSignedBodyBytes is the largest integration request body we read to check its signature.
+const maxSignedBodyBytes = 1 << 20
+
+// nonceCache remembers the nonces of signed requests for as long as their timestamps are
+// accepted, so that a captured request can't be replayed while it would still pass the
+// timestamp check. Like rateLimiter it lives in memory, so each instance only knows about the
+// requests it has seen itself.
+type nonceCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+// newNonceCache returns a nonceCache that remembers nonces for ttl.
+func newNonceCache(ttl time.Duration) *nonceCache {
+	return &nonceCache{ttl: ttl, seen: map[string]time.Time{}}
+}
+
+// use records a nonce and returns whether it is new.
+func (c *nonceCache) use(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Every so often we forget the nonces that are too old to matter, so the map can't grow
+	// forever.
+	if now.Sub(c.lastPrune) >= c.ttl {
+		for n, expires := range c.seen {
+			if now.After(expires) {
+				delete(c.seen, n)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	if expires, ok := c.seen[nonce]; ok && !now.After(expires) {
+		return false
+	}
+	c.seen[nonce] = now.Add(c.ttl)
+	return true
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the parts, joined together, using key.
+func sign(key string, parts ...[]byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkSignature checks a signed request: the timestamp (in Unix seconds) has to be within the
+// configured tolerance of now, the signature has to match, and the nonce can't have been used
+// before. The prefix keeps nonces from different integrations apart.
+func (s *server) checkSignature(prefix, timestamp, nonce, signature, expected string) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	now := s.clock.Now()
+	age := now.Sub(time.Unix(seconds, 0))
+	if age < -s.cfg.SignatureTolerance || age > s.cfg.SignatureTolerance {
+		return false
+	}
+	// `hmac.Equal` compares in constant time, for the same reason as the admin token.
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return false
+	}
+	// The nonce is only recorded once the rest has been checked, so that forged requests
+	// can't use up nonces.
+	return s.nonces.use(prefix+nonce, now)
+}
+
+// checkMailgunSignature checks the signature Mailgun adds to the form of every inbound email:
+// an HMAC of the timestamp and a random token, with the token doubling as the nonce.
+func (s *server) checkMailgunSignature(r *http.Request) bool {
+	timestamp, token := r.FormValue("timestamp"), r.FormValue("token")
+	expected := sign(s.cfg.InboundEmailSigningKey, []byte(timestamp), []byte(token))
+	return s.checkSignature("email:", timestamp, token, r.FormValue("signature"), expected)
+}
+
+// requireSignature wraps an integration action so that it is only run if it is signed with
+// the integration signing secret. The X-Signature header has to hold the hex HMAC-SHA256 of
+// the X-Signature-Timestamp header, a ".", and the body. The signature is the nonce, so the
+// same request can't be sent twice; a retry has to be signed again with a new timestamp.
+//
+// If no secret is configured, requests aren't checked.
+func (s *server) requireSignature(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.IntegrationSigningSecret == "" {
+			next(w, r)
+			return
+		}
+
+		// We need the body to check the signature, and the handler needs it afterwards, so we
+		// read it all and then put a copy back.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodyBytes))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		timestamp, signature := r.Header.Get("X-Signature-Timestamp"), r.Header.Get("X-Signature")
+		expected := sign(s.cfg.IntegrationSigningSecret, []byte(timestamp), []byte("."), body)
+		if !s.checkSignature("integration:", timestamp, signature, signature, expected) {
+			writeError(w, r, http.StatusUnauthorized, "invalid_signature", "")
+			return
+		}
+		next(w, r)
+	}
+}
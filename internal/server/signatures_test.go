@@ -0,0 +1,203 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ls-todo/internal/clock"
+	"ls-todo/internal/config"
+)
+
+const signatureTolerance = 5 * time.Minute
+
+// newSigningServer returns a server with both signing keys set and its clock stopped at now.
+func newSigningServer(now time.Time) (*server, *clock.Fake) {
+	clk := clock.NewFake()
+	clk.Set(now)
+	return &server{
+		cfg: &config.Config{
+			InboundEmailSigningKey:   "email-key",
+			IntegrationSigningSecret: "integration-secret",
+			SignatureTolerance:       signatureTolerance,
+		},
+		clock:  clk,
+		nonces: newNonceCache(2 * signatureTolerance),
+	}, clk
+}
+
+// signedRequest returns an integration action request signed with secret at the given time.
+func signedRequest(secret string, at time.Time, body string) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	r := httptest.NewRequest("POST", "/api/integrations/actions/create_todo", strings.NewReader(body))
+	r.Header.Set("X-Signature-Timestamp", timestamp)
+	r.Header.Set("X-Signature", sign(secret, []byte(timestamp), []byte("."), []byte(body)))
+	return r
+}
+
+func TestRequireSignature(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	const body = `{"title":"Buy milk"}`
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		want    int
+	}{
+		{"valid", func() *http.Request {
+			return signedRequest("integration-secret", now, body)
+		}, http.StatusOK},
+		{"within the tolerance", func() *http.Request {
+			return signedRequest("integration-secret", now.Add(-signatureTolerance+time.Second), body)
+		}, http.StatusOK},
+		{"clock ahead within the tolerance", func() *http.Request {
+			return signedRequest("integration-secret", now.Add(signatureTolerance-time.Second), body)
+		}, http.StatusOK},
+		{"tampered body", func() *http.Request {
+			r := signedRequest("integration-secret", now, body)
+			r.Body = io.NopCloser(strings.NewReader(`{"title":"Buy beer"}`))
+			return r
+		}, http.StatusUnauthorized},
+		{"tampered signature", func() *http.Request {
+			r := signedRequest("integration-secret", now, body)
+			signature := []byte(r.Header.Get("X-Signature"))
+			signature[0] ^= 1
+			r.Header.Set("X-Signature", string(signature))
+			return r
+		}, http.StatusUnauthorized},
+		{"tampered timestamp", func() *http.Request {
+			r := signedRequest("integration-secret", now, body)
+			r.Header.Set("X-Signature-Timestamp", strconv.FormatInt(now.Unix()-1, 10))
+			return r
+		}, http.StatusUnauthorized},
+		{"wrong secret", func() *http.Request {
+			return signedRequest("other-secret", now, body)
+		}, http.StatusUnauthorized},
+		{"too old", func() *http.Request {
+			return signedRequest("integration-secret", now.Add(-signatureTolerance-time.Second), body)
+		}, http.StatusUnauthorized},
+		{"too far in the future", func() *http.Request {
+			return signedRequest("integration-secret", now.Add(signatureTolerance+time.Second), body)
+		}, http.StatusUnauthorized},
+		{"missing headers", func() *http.Request {
+			return httptest.NewRequest("POST", "/api/integrations/actions/create_todo", strings.NewReader(body))
+		}, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		s, _ := newSigningServer(now)
+		var got string
+		handler := s.requireSignature(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			got = string(data)
+		})
+		w := httptest.NewRecorder()
+		handler(w, test.request())
+		if w.Code != test.want {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.want)
+		}
+		// The handler has to get the body that was checked.
+		if w.Code == http.StatusOK && got != body {
+			t.Errorf("%s: handler read %q, want %q", test.name, got, body)
+		}
+	}
+}
+
+func TestRequireSignatureRejectsReplays(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	s, clk := newSigningServer(now)
+	handler := s.requireSignature(func(w http.ResponseWriter, r *http.Request) {})
+	send := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	first := signedRequest("integration-secret", now, "{}")
+	replay := signedRequest("integration-secret", now, "{}")
+	if code := send(first); code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := send(replay); code != http.StatusUnauthorized {
+		t.Errorf("replay: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// Once the cache has forgotten the nonce, the timestamp is too old to be accepted, so a
+	// replay still fails.
+	clk.Advance(2*signatureTolerance + time.Second)
+	if !s.nonces.use("integration:unrelated", clk.Now()) {
+		t.Fatal("a new nonce was rejected")
+	}
+	if _, ok := s.nonces.seen["integration:"+replay.Header.Get("X-Signature")]; ok {
+		t.Fatal("the cache still holds the nonce")
+	}
+	if code := send(signedRequest("integration-secret", now, "{}")); code != http.StatusUnauthorized {
+		t.Errorf("replay after eviction: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	c := newNonceCache(time.Minute)
+	if !c.use("a", now) {
+		t.Error("first use of a was rejected")
+	}
+	if c.use("a", now.Add(time.Minute)) {
+		t.Error("a was accepted again before it expired")
+	}
+	if !c.use("b", now.Add(time.Second)) {
+		t.Error("first use of b was rejected")
+	}
+	if !c.use("a", now.Add(time.Minute+time.Second)) {
+		t.Error("a was rejected after it expired")
+	}
+}
+
+func TestCheckMailgunSignature(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	form := func(key, timestamp, token string) *http.Request {
+		values := url.Values{
+			"timestamp": {timestamp},
+			"token":     {token},
+			"signature": {sign(key, []byte(timestamp), []byte(token))},
+		}
+		r := httptest.NewRequest("POST", "/api/inbound/email", strings.NewReader(values.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	old := strconv.FormatInt(now.Add(-signatureTolerance-time.Second).Unix(), 10)
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		want    bool
+	}{
+		{"valid", form("email-key", timestamp, "token-1"), true},
+		{"wrong key", form("other-key", timestamp, "token-2"), false},
+		{"too old", form("email-key", old, "token-3"), false},
+		{"replayed token", form("email-key", timestamp, "token-1"), false},
+	}
+	s, _ := newSigningServer(now)
+	for _, test := range tests {
+		if got := s.checkMailgunSignature(test.request); got != test.want {
+			t.Errorf("%s: checkMailgunSignature = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// A tampered token no longer matches the signature.
+	r := form("email-key", timestamp, "token-4")
+	r.ParseForm()
+	r.Form.Set("token", "token-5")
+	if s.checkMailgunSignature(r) {
+		t.Error("tampered token: checkMailgunSignature = true, want false")
+	}
+	// Integration nonces are kept apart from email ones.
+	if !s.nonces.use("integration:token-1", now) {
+		t.Error("an email token blocked the same integration nonce")
+	}
+}
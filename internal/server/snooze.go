@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"ls-todo/internal/models"
+)
+
+// maxShiftDays is the furthest, in days, a todo can be snoozed or rescheduled in one go.
+const maxShiftDays = 3660
+
+// intervalPattern matches intervals like `3d` and `-2w`: a whole number of days or weeks.
+var intervalPattern = regexp.MustCompile(`^(-?\d+)([dw])$`)
+
+// parseInterval parses an interval like `3d` or `-2w` into a number of days.
+func parseInterval(interval string) (int, bool) {
+	match := intervalPattern.FindStringSubmatch(interval)
+	if match == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(match[1])
+	// We check the range before converting weeks to days, since a huge number of weeks could
+	// overflow into the range.
+	if err != nil || n == 0 || n < -maxShiftDays || n > maxShiftDays {
+		return 0, false
+	}
+	if match[2] == "w" {
+		n *= 7
+	}
+	if n < -maxShiftDays || n > maxShiftDays {
+		return 0, false
+	}
+	return n, true
+}
+
+// snoozeUntil works out the date a todo snoozed for the given duration is due, as of today.
+// Due dates don't have a time, so `tonight` means today and `next_week` means next Monday;
+// otherwise the duration is an interval like `1d` or `2w`, which can't be negative.
+func snoozeUntil(duration string, today time.Time) (time.Time, bool) {
+	switch duration {
+	case "tonight":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	case "next_week":
+		// time.Weekday counts from Sunday, so Monday is 1. A Monday goes to the one after.
+		days := (int(time.Monday)-int(today.Weekday())+6)%7 + 1
+		return today.AddDate(0, 0, days), true
+	}
+	days, ok := parseInterval(duration)
+	if !ok || days < 0 {
+		return time.Time{}, false
+	}
+	return today.AddDate(0, 0, days), true
+}
+
+// snooze is the request body for HandleSnoozeTodo.
+type snooze struct {
+	Duration string `json:"duration"`
+}
+
+// HandleSnoozeTodo moves a todo's due date to later, worked out from today in the server's
+// time zone rather than from the current due date, so that snoozing an overdue todo for a day
+// makes it due tomorrow.
+func (s *server) HandleSnoozeTodo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "")
+		return
+	}
+
+	var body snooze
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	due, ok := snoozeUntil(body.Duration, s.clock.Now().In(s.loc))
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "invalid_duration", "")
+		return
+	}
+
+	// A snooze is an update of just the due date, so it is recorded in the todo's history
+	// like any other.
+	diff := &models.Todo{
+		Day:   fmt.Sprintf("%02d", due.Day()),
+		Month: fmt.Sprintf("%02d", due.Month()),
+		Year:  fmt.Sprintf("%04d", due.Year()),
+	}
+	todo, err := s.db.UpdateTodo(diff, id)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if todo == nil {
+		writeError(w, r, http.StatusNotFound, "todo_not_found", "")
+		return
+	}
+
+	s.computeFields(todo)
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// reschedule is the request body for HandleRescheduleTodos.
+type reschedule struct {
+	IDs []int64 `json:"ids"`
+	// By is the interval to shift the due dates by, like `3d` or `-1w`.
+	By string `json:"by"`
+}
+
+// rescheduled is the response body for HandleRescheduleTodos.
+type rescheduled struct {
+	Todos []*models.Todo `json:"todos"`
+	// Skipped are the ids that weren't rescheduled, because there is no such todo or it has
+	// no due date.
+	Skipped []int64 `json:"skipped"`
+}
+
+// HandleRescheduleTodos shifts the due dates of a set of todos by the same interval, all at
+// once: either every todo that can be rescheduled is, or none are.
+func (s *server) HandleRescheduleTodos(w http.ResponseWriter, r *http.Request) {
+	var body reschedule
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	// The ids are bounded like a page, so one request can't lock the whole table.
+	if len(body.IDs) == 0 || len(body.IDs) > s.cfg.MaxPageSize {
+		writeError(w, r, http.StatusBadRequest, "invalid_ids", "")
+		return
+	}
+	days, ok := parseInterval(body.By)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "invalid_duration", "")
+		return
+	}
+
+	todos, err := s.db.RescheduleTodos(body.IDs, days)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	done := map[int64]bool{}
+	for _, todo := range todos {
+		done[todo.ID] = true
+	}
+	skipped := []int64{}
+	for _, id := range body.IDs {
+		if !done[id] {
+			skipped = append(skipped, id)
+			// An id sent twice is only skipped once.
+			done[id] = true
+		}
+	}
+
+	s.computeFields(todos...)
+	if err := json.NewEncoder(w).Encode(rescheduled{Todos: todos, Skipped: skipped}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
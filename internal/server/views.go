@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"ls-todo/internal/db"
+	"ls-todo/internal/models"
+)
+
+// clientIDHeader identifies the client saved list views belong to. There are no user accounts,
+// so each client picks an id (e.g. one per user of the client) and sends it with every request
+// that uses saved views. The id isn't a secret or proof of anything; it only keeps different
+// clients' views apart.
+const clientIDHeader = "X-Client-ID"
+
+// builtInView reports whether name is one of the views every client has, as opposed to one a
+// client saved.
+func builtInView(name string) bool {
+	return name == "" || name == "full" || name == "summary"
+}
+
+func (s *server) HandleGetListViews(w http.ResponseWriter, r *http.Request) {
+	clientID := r.Header.Get(clientIDHeader)
+	if clientID == "" {
+		writeError(w, r, http.StatusBadRequest, "missing_client_id", "")
+		return
+	}
+
+	views, err := s.db.GetListViews(clientID)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(views); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandlePutListView(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clientID := r.Header.Get(clientIDHeader)
+	if clientID == "" {
+		writeError(w, r, http.StatusBadRequest, "missing_client_id", "")
+		return
+	}
+
+	var view models.ListView
+	if err := json.NewDecoder(r.Body).Decode(&view); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "")
+		return
+	}
+	// The name in the path wins over any name in the body.
+	view.ClientID, view.Name = clientID, vars["name"]
+	// We check the parameters now rather than when the view is used, so that a saved view
+	// always works. The database checks the name and layout.
+	if _, err := db.ParseSort(view.Sort); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_sort", "")
+		return
+	}
+	if view.PageSize < 0 || view.PageSize > s.cfg.MaxPageSize {
+		writeError(w, r, http.StatusBadRequest, "invalid_page_size", "")
+		return
+	}
+	for _, value := range view.Filters {
+		if _, ok := value.(string); !ok {
+			writeError(w, r, http.StatusBadRequest, "invalid_filters", "")
+			return
+		}
+	}
+
+	saved, err := s.db.PutListView(&view)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(saved); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *server) HandleDeleteListView(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clientID := r.Header.Get(clientIDHeader)
+	if clientID == "" {
+		writeError(w, r, http.StatusBadRequest, "missing_client_id", "")
+		return
+	}
+
+	view, err := s.db.DeleteListView(clientID, vars["name"])
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return
+	}
+	if view == nil {
+		writeError(w, r, http.StatusNotFound, "view_not_found", "")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// applyListView handles `?view=<name>` for a saved view. It returns a copy of the request with
+// the view's parameters added to the query, except for those the request already has, so that
+// a client can still change the page or order of a saved view. The `view` parameter itself is
+// replaced with the view's layout, so the rest of the handler only ever sees a built-in view.
+//
+// If the view can't be used, the error response is written and the second value is false.
+func (s *server) applyListView(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	query := r.URL.Query()
+	name := query.Get("view")
+	if builtInView(name) {
+		return r, true
+	}
+	clientID := r.Header.Get(clientIDHeader)
+	if clientID == "" {
+		writeError(w, r, http.StatusBadRequest, "missing_client_id", "")
+		return r, false
+	}
+
+	view, err := s.db.GetListView(clientID, name)
+	if err != nil {
+		s.writeDBError(w, r, err)
+		return r, false
+	}
+	if view == nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_view", "")
+		return r, false
+	}
+
+	// A cursor carries its own order, so the view's sort only applies without one.
+	if view.Sort != "" && !query.Has("sort") && !query.Has("cursor") {
+		query.Set("sort", view.Sort)
+	}
+	if view.PageSize > 0 && !query.Has("limit") {
+		query.Set("limit", strconv.Itoa(view.PageSize))
+	}
+	for field, value := range view.Filters {
+		// PutListView only saves string values.
+		if key := "cf." + field; !query.Has(key) {
+			query.Set(key, value.(string))
+		}
+	}
+	query.Set("view", view.Layout)
+
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query.Encode()
+	return r, true
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"ls-todo/internal/db"
+	"ls-todo/internal/models"
+)
+
+func TestSavedListViews(t *testing.T) {
+	database := &fakeDB{
+		todos: testTodos(),
+		views: map[string]map[string]*models.ListView{
+			"phone": {
+				"sprint": {
+					Name: "sprint", Sort: "-created_at", PageSize: 5, Layout: "summary",
+					Filters: models.JSONObject{"sprint": "12"},
+				},
+			},
+		},
+	}
+	s := newTestServer(t, database)
+
+	tests := []struct {
+		target   string
+		clientID string
+		status   int
+		opts     db.ListOptions
+		summary  bool
+	}{
+		{
+			target: "/api/todos?view=sprint", clientID: "phone", status: http.StatusOK,
+			opts: db.ListOptions{
+				Limit:        5,
+				Sort:         []db.SortKey{{Field: "created_at", Desc: true}},
+				CustomFields: map[string]string{"sprint": "12"},
+			},
+			summary: true,
+		},
+		{
+			// Parameters in the request win over the view's.
+			target: "/api/todos?view=sprint&limit=2&sort=title&cf.sprint=13", clientID: "phone",
+			status: http.StatusOK,
+			opts: db.ListOptions{
+				Limit:        2,
+				Sort:         []db.SortKey{{Field: "title"}},
+				CustomFields: map[string]string{"sprint": "13"},
+			},
+			summary: true,
+		},
+		{target: "/api/todos?view=sprint", status: http.StatusBadRequest},
+		{target: "/api/todos?view=sprint", clientID: "laptop", status: http.StatusBadRequest},
+		{target: "/api/todos/starred?view=sprint", clientID: "phone", status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		database.opts = db.ListOptions{}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", test.target, nil)
+		if test.clientID != "" {
+			r.Header.Set(clientIDHeader, test.clientID)
+		}
+		s.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s as %q: status = %d, want %d: %s", test.target, test.clientID, w.Code, test.status, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		if !reflect.DeepEqual(database.opts, test.opts) {
+			t.Errorf("%s: options = %+v, want %+v", test.target, database.opts, test.opts)
+		}
+		var body []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decoding response: %v", test.target, err)
+		}
+		if _, truncated := body[0]["description_truncated"]; truncated != test.summary {
+			t.Errorf("%s: summary = %v, want %v", test.target, truncated, test.summary)
+		}
+	}
+}
+
+func TestListViewsMatchSchema(t *testing.T) {
+	compiled := compileSchemas(t)
+	s := newTestServer(t, &fakeDB{views: map[string]map[string]*models.ListView{
+		"phone": {"today": {Name: "today", Sort: "due_date", Filters: models.JSONObject{}}},
+	}})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/me/views", nil)
+	r.Header.Set(clientIDHeader, "phone")
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var views []interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &views); err != nil || len(views) != 1 {
+		t.Fatalf("want one view, got %s (%v)", w.Body, err)
+	}
+	if err := compiled["list_view.json"].Validate(views[0]); err != nil {
+		t.Errorf("response doesn't match list_view.json: %v", err)
+	}
+
+	if w := serve(s, "GET", "/api/me/views", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("without %s: status = %d, want %d", clientIDHeader, w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,28 @@
+package version
+
+// These are set at build time using the linker's `-X` flag, e.g.
+//
+//	go build -ldflags "-X ls-todo/internal/version.Version=1.2.0 -X ls-todo/internal/version.Commit=$(git rev-parse HEAD)"
+//
+// They have to be variables (not constants) for that to work. Builds that don't set them
+// (e.g. `go run`) report the defaults below.
+var (
+	// Version is the release version of the build.
+	Version = "dev"
+	// Commit is the git SHA the build was made from.
+	Commit = "unknown"
+	// BuildDate is when the build was made, in RFC 3339 format.
+	BuildDate = "unknown"
+)
+
+// Info is the build information reported by the API.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// Get returns the build information.
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildDate: BuildDate}
+}
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+
+-- We don't know when existing todos were completed, so we treat them as if they were
+-- completed when this migration ran. This means they won't be purged straight away.
+UPDATE todos SET completed_at = now() WHERE completed;
+
+COMMIT;
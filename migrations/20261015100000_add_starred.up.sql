@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS starred BOOL DEFAULT 'f' NOT NULL;
+
+COMMIT;
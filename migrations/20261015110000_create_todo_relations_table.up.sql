@@ -0,0 +1,22 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS todo_relations (
+    id SERIAL PRIMARY KEY,
+    -- Relations are stored once, in the direction they were created. For `duplicate_of` the
+    -- direction matters (from_todo_id is the duplicate); `related` works both ways.
+    from_todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    to_todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('related', 'duplicate_of')),
+    CHECK (from_todo_id <> to_todo_id),
+    UNIQUE (from_todo_id, to_todo_id, kind)
+);
+
+-- Since `related` has no direction, A related to B is the same relation as B related to A.
+-- Indexing on the smaller and larger ids stops both from being stored.
+CREATE UNIQUE INDEX IF NOT EXISTS todo_relations_related_unique
+    ON todo_relations (LEAST(from_todo_id, to_todo_id), GREATEST(from_todo_id, to_todo_id))
+    WHERE kind = 'related';
+
+CREATE INDEX IF NOT EXISTS todo_relations_to_todo_id ON todo_relations (to_todo_id);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS todos_custom_fields;
+ALTER TABLE todos DROP COLUMN IF EXISTS custom_fields;
+DROP TABLE IF EXISTS custom_field_definitions;
+
+COMMIT;
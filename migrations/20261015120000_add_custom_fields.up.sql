@@ -0,0 +1,16 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS custom_field_definitions (
+    name TEXT PRIMARY KEY CHECK (name ~ '^[a-z][a-z0-9_]*$'),
+    type TEXT NOT NULL CHECK (type IN ('text', 'number', 'date', 'select')),
+    -- The allowed values of a select field. Empty for the other types.
+    options TEXT[] DEFAULT '{}' NOT NULL
+);
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS custom_fields JSONB DEFAULT '{}' NOT NULL;
+
+-- A GIN index lets PostgreSQL use the index for containment queries like
+-- `custom_fields @> '{"sprint": "12"}'`.
+CREATE INDEX IF NOT EXISTS todos_custom_fields ON todos USING GIN (custom_fields);
+
+COMMIT;
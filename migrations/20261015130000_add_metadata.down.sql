@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS metadata;
+
+COMMIT;
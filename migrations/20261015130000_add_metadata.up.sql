@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS metadata JSONB DEFAULT '{}' NOT NULL;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS todo_events ON todos;
+DROP FUNCTION IF EXISTS record_todo_event();
+DROP TABLE IF EXISTS todo_events;
+
+COMMIT;
@@ -0,0 +1,39 @@
+BEGIN;
+
+-- Every change to a todo is recorded here by the trigger below, along with the full state of
+-- the todo after the change (or before it, for deletions). There is deliberately no foreign
+-- key to todos: the history has to outlive the todo it belongs to.
+CREATE TABLE IF NOT EXISTS todo_events (
+    id BIGSERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('created', 'updated', 'deleted')),
+    state JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS todo_events_todo_id_created_at ON todo_events (todo_id, created_at);
+
+-- Recording events in a trigger rather than in the application means no write can skip it,
+-- including the ones made by hand or by a migration.
+CREATE OR REPLACE FUNCTION record_todo_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO todo_events (todo_id, kind, state) VALUES (OLD.id, 'deleted', to_jsonb(OLD));
+        RETURN OLD;
+    END IF;
+    INSERT INTO todo_events (todo_id, kind, state)
+        VALUES (NEW.id, CASE TG_OP WHEN 'INSERT' THEN 'created' ELSE 'updated' END, to_jsonb(NEW));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS todo_events ON todos;
+CREATE TRIGGER todo_events AFTER INSERT OR UPDATE OR DELETE ON todos
+    FOR EACH ROW EXECUTE PROCEDURE record_todo_event();
+
+-- We have no history for existing todos, so we start it off with their current state. Asking
+-- for a todo as it was before this migration ran will therefore find nothing.
+INSERT INTO todo_events (todo_id, kind, state)
+    SELECT id, 'created', to_jsonb(todos) FROM todos;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS todos_due;
+DROP INDEX IF EXISTS todos_completed_at;
+DROP INDEX IF EXISTS todos_starred_id;
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+-- Lists are ordered with starred todos first, then by id.
+CREATE INDEX IF NOT EXISTS todos_starred_id ON todos (starred DESC, id);
+
+-- The retention purge and the completed todos trigger only look at completed todos, by when
+-- they were completed.
+CREATE INDEX IF NOT EXISTS todos_completed_at ON todos (completed_at) WHERE completed;
+
+-- Reports group and filter todos by their due date.
+CREATE INDEX IF NOT EXISTS todos_due ON todos (year, month, day);
+
+COMMIT;
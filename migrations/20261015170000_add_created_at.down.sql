@@ -0,0 +1,8 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS todos_due ON todos (year, month, day);
+DROP INDEX IF EXISTS todos_due_id;
+DROP INDEX IF EXISTS todos_created_at_id;
+ALTER TABLE todos DROP COLUMN IF EXISTS created_at;
+
+COMMIT;
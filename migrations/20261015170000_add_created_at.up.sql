@@ -0,0 +1,13 @@
+BEGIN;
+
+-- We don't know when existing todos were created, so they all get the time this migration ran.
+-- Their ids still give their creation order, and keyset pagination breaks ties on id.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT now() NOT NULL;
+
+-- Keyset pagination seeks to a position in one of these orders, so each needs an index
+-- ending in id. The second replaces the due date index, which it covers.
+CREATE INDEX IF NOT EXISTS todos_created_at_id ON todos (created_at, id);
+CREATE INDEX IF NOT EXISTS todos_due_id ON todos (year, month, day, id);
+DROP INDEX IF EXISTS todos_due;
+
+COMMIT;
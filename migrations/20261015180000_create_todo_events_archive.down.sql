@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Put any archived events back so that rolling back doesn't lose history.
+INSERT INTO todo_events (id, todo_id, kind, state, created_at)
+    SELECT id, todo_id, kind, state, created_at FROM todo_events_archive
+    ON CONFLICT (id) DO NOTHING;
+
+DROP TABLE IF EXISTS todo_events_archive;
+
+COMMIT;
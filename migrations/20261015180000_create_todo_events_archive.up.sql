@@ -0,0 +1,20 @@
+BEGIN;
+
+-- Old events are moved here by the archive-todo-events job so that todo_events, which is
+-- written on every change, stays small. The archive has the same columns, keeps the original
+-- ids, and is only read when asking for a todo as it was a long time ago.
+CREATE TABLE IF NOT EXISTS todo_events_archive (
+    id BIGINT PRIMARY KEY,
+    todo_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    state JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS todo_events_archive_todo_id_created_at
+    ON todo_events_archive (todo_id, created_at);
+
+-- The purge step deletes from the archive by age, so it needs an index on its own.
+CREATE INDEX IF NOT EXISTS todo_events_archive_created_at ON todo_events_archive (created_at);
+
+COMMIT;
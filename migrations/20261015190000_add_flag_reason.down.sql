@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS todos_flagged;
+ALTER TABLE todos DROP COLUMN IF EXISTS flag_reason;
+
+COMMIT;
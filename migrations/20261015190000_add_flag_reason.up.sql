@@ -0,0 +1,10 @@
+BEGIN;
+
+-- A todo is flagged by the content filter when it should be reviewed by an admin. The reason
+-- is NULL for todos that aren't flagged, which is nearly all of them, so the index only
+-- covers the flagged ones.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS flag_reason TEXT;
+
+CREATE INDEX IF NOT EXISTS todos_flagged ON todos (id) WHERE flag_reason IS NOT NULL;
+
+COMMIT;
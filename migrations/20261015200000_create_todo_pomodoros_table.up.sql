@@ -0,0 +1,20 @@
+BEGIN;
+
+-- A pomodoro is a session of focused work on a todo. It is running until it is completed, and
+-- the time between the two is counted as focus time.
+CREATE TABLE IF NOT EXISTS todo_pomodoros (
+    id SERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    started_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    CHECK (completed_at >= started_at)
+);
+
+CREATE INDEX IF NOT EXISTS todo_pomodoros_todo_id ON todo_pomodoros (todo_id);
+-- Only one pomodoro can be running on a todo at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS todo_pomodoros_running ON todo_pomodoros (todo_id)
+    WHERE completed_at IS NULL;
+-- The daily focus stats look pomodoros up by when they were completed.
+CREATE INDEX IF NOT EXISTS todo_pomodoros_completed_at ON todo_pomodoros (completed_at);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS todos_latitude;
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS todos_location_complete;
+ALTER TABLE todos DROP COLUMN IF EXISTS radius_meters;
+ALTER TABLE todos DROP COLUMN IF EXISTS longitude;
+ALTER TABLE todos DROP COLUMN IF EXISTS latitude;
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+-- A todo can have a place it should be done at. When a client reports a location within the
+-- radius, the todo is returned so the client can remind its user. The three columns are set
+-- together or not at all.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION
+    CHECK (latitude BETWEEN -90 AND 90);
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION
+    CHECK (longitude BETWEEN -180 AND 180);
+-- The largest radius has to match maxReminderRadius in the db package.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS radius_meters INTEGER
+    CHECK (radius_meters BETWEEN 1 AND 50000);
+-- ADD CONSTRAINT has no IF NOT EXISTS, so we drop it first to keep the migration re-runnable.
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS todos_location_complete;
+ALTER TABLE todos ADD CONSTRAINT todos_location_complete
+    CHECK ((latitude IS NULL) = (longitude IS NULL) AND (latitude IS NULL) = (radius_meters IS NULL));
+
+-- Nearby todos are narrowed down by latitude before working out exact distances. Few todos
+-- have a location, so the index only covers those.
+CREATE INDEX IF NOT EXISTS todos_latitude ON todos (latitude) WHERE latitude IS NOT NULL;
+
+COMMIT;
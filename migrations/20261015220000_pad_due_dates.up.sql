@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Due dates are sorted (and paged through with cursors) as text, which only gives date order
+-- when the parts are zero-padded. Todos are padded when they're saved, but older ones may not
+-- be, so we pad every part that is a number. Parts that aren't numbers are left alone; they
+-- never counted as due dates.
+--
+-- Padding doesn't change what a todo says, so we don't record it in the todos' history.
+ALTER TABLE todos DISABLE TRIGGER todo_events;
+
+UPDATE todos
+   SET day   = CASE WHEN day ~ '^\d$' THEN lpad(day, 2, '0') ELSE day END,
+       month = CASE WHEN month ~ '^\d$' THEN lpad(month, 2, '0') ELSE month END,
+       year  = CASE WHEN year ~ '^\d{1,3}$' THEN lpad(year, 4, '0') ELSE year END
+ WHERE day ~ '^\d$' OR month ~ '^\d$' OR year ~ '^\d{1,3}$';
+
+ALTER TABLE todos ENABLE TRIGGER todo_events;
+
+COMMIT;
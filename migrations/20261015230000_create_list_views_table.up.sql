@@ -0,0 +1,21 @@
+BEGIN;
+
+-- A list view is a named set of list parameters a client saved, so that the same list follows
+-- its user across devices. There are no user accounts, so views belong to the client id sent
+-- in the X-Client-ID header.
+CREATE TABLE IF NOT EXISTS list_views (
+    client_id TEXT NOT NULL CHECK (client_id <> '' AND length(client_id) <= 200),
+    -- full and summary are the built-in views, so a saved view can't take their names.
+    name TEXT NOT NULL CHECK (name ~ '^[a-z][a-z0-9_-]*$' AND name NOT IN ('full', 'summary')),
+    -- sort is written like the `sort` query parameter. Empty means the default order.
+    sort TEXT DEFAULT '' NOT NULL,
+    -- filters are the custom field filters, like the `cf.<name>` query parameters.
+    filters JSONB DEFAULT '{}' NOT NULL,
+    -- page_size is the number of todos per page. Zero means the default page size.
+    page_size INTEGER DEFAULT 0 NOT NULL CHECK (page_size >= 0),
+    layout TEXT DEFAULT '' NOT NULL CHECK (layout IN ('', 'full', 'summary')),
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (client_id, name)
+);
+
+COMMIT;